@@ -1,21 +1,94 @@
 package api
 
-import "vega-cli-mm/store"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"vega-cli-mm/funding"
+	"vega-cli-mm/income"
+	"vega-cli-mm/inventory"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/pnl"
+	"vega-cli-mm/store"
+)
 
 type Api struct {
-	store *store.Store
+	store     *store.Store
+	pnl       *pnl.Pnl
+	income    *income.Income
+	inventory *inventory.Inventory
+	funding   *funding.Funding
+	address   string
 }
 
 func NewApi(
 	store *store.Store,
+	pnl *pnl.Pnl,
+	income *income.Income,
+	inventory *inventory.Inventory,
+	funding *funding.Funding,
+	address string,
 ) *Api {
 	return &Api{
-		store: store,
+		store:     store,
+		pnl:       pnl,
+		income:    income,
+		inventory: inventory,
+		funding:   funding,
+		address:   address,
 	}
 }
 
 func (a *Api) Start() {
 	go func() {
-		// TODO - start the API
+		mux := http.NewServeMux()
+		mux.HandleFunc("/pnl", a.getPnl)
+		mux.HandleFunc("/income", a.getIncome)
+		mux.HandleFunc("/readiness", a.getReadiness)
+		mux.HandleFunc("/inventory", a.getInventory)
+		mux.HandleFunc("/funding", a.getFunding)
+		mux.HandleFunc("/pow", a.getPow)
+		mux.HandleFunc("/transactions", a.getTransactions)
+		logging.GetLogger().Infof("starting api on %s", a.address)
+		err := http.ListenAndServe(a.address, mux)
+		if err != nil {
+			logging.Panic(fmt.Sprintf("error starting api: %v", err))
+		}
 	}()
 }
+
+func (a *Api) getPnl(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, a.pnl.GetPnl())
+}
+
+func (a *Api) getIncome(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, a.income.GetIncome())
+}
+
+func (a *Api) getReadiness(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, a.store.GetMarketReadiness())
+}
+
+func (a *Api) getInventory(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, a.inventory.GetInventory())
+}
+
+func (a *Api) getFunding(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, a.funding.GetFunding())
+}
+
+func (a *Api) getPow(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, a.store.GetPowStats())
+}
+
+func (a *Api) getTransactions(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, a.store.GetTxRecords())
+}
+
+func (a *Api) writeJson(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		logging.GetLogger().Warnf("could not write api response: %v", err)
+	}
+}
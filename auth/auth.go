@@ -2,78 +2,67 @@ package auth
 
 import (
 	"bytes"
-	"code.vegaprotocol.io/vega/libs/crypto"
 	"code.vegaprotocol.io/vega/libs/proto"
 	corepb "code.vegaprotocol.io/vega/protos/vega/api/v1"
 	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
 	"context"
-	"crypto/ed25519"
 	"encoding/hex"
-	"github.com/google/uuid"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/sasha-s/go-deadlock"
-	"golang.org/x/crypto/sha3"
-	"golang.org/x/exp/maps"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
 	"log"
-	"math"
 	"math/rand"
-	"sort"
-	"strconv"
-	"sync"
 	"time"
+	"vega-cli-mm/journal"
 	"vega-cli-mm/logging"
 	"vega-cli-mm/store"
 )
 
-const NumberOfPastBlocksKey = "spam.pow.numberOfPastBlocks"
-const TxPerBlockKey = "spam.pow.numberOfTxPerBlock"
+// PowWaitTimeout is how long callers that don't need a transaction sent urgently should wait for proof of work
+const PowWaitTimeout = 5 * time.Second
 
-type ProofOfWork struct {
-	BlockHash   string
-	BlockHeight uint64
-	Difficulty  uint
-	Nonce       uint64
-	TxId        string
-	Used        bool
-}
+// lastBlockTimeout bounds each poll of the last block by the PoW tickers, so a slow node can't pile them up
+const lastBlockTimeout = time.Second
 
-func NewProofOfWork(
-	blockHash string,
-	blockHeight uint64,
-	difficulty uint,
-	nonce uint64,
-	txId string,
-	used bool,
-) *ProofOfWork {
-	return &ProofOfWork{
-		BlockHash:   blockHash,
-		BlockHeight: blockHeight,
-		Difficulty:  difficulty,
-		Nonce:       nonce,
-		TxId:        txId,
-		Used:        used,
-	}
-}
+var ErrNoProofOfWork = errors.New("no proof of work available")
 
 type Authenticator struct {
-	coreNode   string
-	wallet     *Wallet
-	mu         deadlock.RWMutex
-	powByBlock map[uint64][]*ProofOfWork
-	store      *store.Store
+	coreNode      string
+	signer        Signer
+	powPool       *PowPool
+	store         *store.Store
+	journal       *journal.Journal
+	spamStats     map[string]*spamStatsEntry
+	spamStatsLock deadlock.Mutex
+}
+
+// spamStatsEntry holds a party's spam statistics as fetched at a block height
+type spamStatsEntry struct {
+	blockHeight uint64
+	stats       *corepb.PoWStatistic
 }
 
 func NewAuthenticator(
 	coreNode string,
-	wallet *Wallet,
+	signer Signer,
 	store *store.Store,
+	journal *journal.Journal,
 ) *Authenticator {
 	authenticator := &Authenticator{
-		coreNode:   coreNode,
-		wallet:     wallet,
-		powByBlock: map[uint64][]*ProofOfWork{},
-		store:      store,
+		coreNode:  coreNode,
+		signer:    signer,
+		powPool:   NewPowPool(store),
+		store:     store,
+		journal:   journal,
+		spamStats: map[string]*spamStatsEntry{},
+	}
+	if _, ok := signer.(TransactionSigner); ok {
+		// the signer computes the proof of work for every transaction it builds
+		return authenticator
 	}
 	go func() {
 		for range time.NewTicker(time.Second).C {
@@ -89,156 +78,131 @@ func NewAuthenticator(
 }
 
 func (a *Authenticator) removeOldProofOfWork() {
-	lastBlock := a.getLastBlock()
+	ctx, cancel := context.WithTimeout(context.Background(), lastBlockTimeout)
+	defer cancel()
+	lastBlock := a.getLastBlock(ctx)
 	if lastBlock == nil {
 		return
 	}
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	numberOfPastBlocksParam := a.store.GetNetworkParameter(NumberOfPastBlocksKey)
-	if numberOfPastBlocksParam == nil {
-		logging.GetLogger().Warnf("cannot get network parameter: %s", NumberOfPastBlocksKey)
-		return
-	}
-	numberOfPastBlocks, err := strconv.ParseFloat(numberOfPastBlocksParam.Value, 0)
-	if err != nil {
-		logging.GetLogger().Warnf("cannot get network parameter: %s", NumberOfPastBlocksKey)
-		return
-	}
-	oldestBlock := lastBlock.Height - uint64(math.Round(0.8*numberOfPastBlocks))
-	for _, height := range maps.Keys(a.powByBlock) {
-		if height <= oldestBlock {
-			delete(a.powByBlock, height)
-		}
-	}
+	a.powPool.Prune(lastBlock)
 }
 
 func (a *Authenticator) computeProofOfWork() {
-	lastBlock := a.getLastBlock()
+	ctx, cancel := context.WithTimeout(context.Background(), lastBlockTimeout)
+	defer cancel()
+	lastBlock := a.getLastBlock(ctx)
 	if lastBlock == nil {
 		return
 	}
-	a.mu.Lock()
-	if ok := a.powByBlock[lastBlock.Height]; ok == nil {
-		a.powByBlock[lastBlock.Height] = make([]*ProofOfWork, 0)
-	}
-	powCount := len(a.powByBlock[lastBlock.Height])
-	a.mu.Unlock()
-	txPerBlockParam := a.store.GetNetworkParameter(TxPerBlockKey)
-	if txPerBlockParam == nil {
-		logging.GetLogger().Warnf("cannot get network parameter: %s", TxPerBlockKey)
-		return
-	}
-	txPerBlock, err := strconv.ParseFloat(txPerBlockParam.Value, 0)
-	if err != nil {
-		logging.GetLogger().Warnf("cannot get network parameter: %s", TxPerBlockKey)
-		return
-	}
-	if powCount == 0 {
-		total := 10.0
-		var wg sync.WaitGroup
-		for i := 0; i < int(total); i++ {
-			wg.Add(1)
-			i := i
-			go func() {
-				difficulty := uint(lastBlock.GetSpamPowDifficulty())
-				extraZeroes := uint(math.Floor(float64(i+1) / txPerBlock))
-				difficulty = difficulty + extraZeroes
-				txId, _ := uuid.NewRandom()
-				nonce, _, _ := crypto.PoW(lastBlock.Hash, txId.String(), difficulty, lastBlock.SpamPowHashFunction)
-				pow := NewProofOfWork(
-					lastBlock.Hash, lastBlock.Height, difficulty, nonce, txId.String(), false,
-				)
-				a.mu.Lock()
-				a.powByBlock[lastBlock.Height] = append(a.powByBlock[lastBlock.Height], pow)
-				a.mu.Unlock()
-				wg.Done()
-			}()
-		}
-		wg.Wait()
-		logging.GetLogger().Debugf("computed %f pow", total)
-	}
+	a.powPool.Refill(lastBlock)
 }
 
+// HasProofOfWork is always true for a signer that computes its own proof of work
 func (a *Authenticator) HasProofOfWork() bool {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	var result = false
-	for _, height := range maps.Keys(a.powByBlock) {
-		for _, pow := range a.powByBlock[height] {
-			if !pow.Used {
-				result = true
-				break
-			}
-		}
+	if _, ok := a.signer.(TransactionSigner); ok {
+		return true
 	}
-	return result
+	return a.powPool.Depth() > 0
 }
 
-func (a *Authenticator) taintProofOfWork(blockHeight uint64, txId string) {
-	powList := a.powByBlock[blockHeight]
-	if powList != nil {
-		for i, pow := range powList {
-			if pow.TxId == txId {
-				powList[i].Used = true
-			}
+func (a *Authenticator) getLastBlock(ctx context.Context) *corepb.LastBlockHeightResponse {
+	req := &corepb.LastBlockHeightRequest{}
+	coreNode, err := grpc.Dial(a.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Printf("couldn't get last block: %v\n", err)
+		return nil
+	}
+	defer func() {
+		if err := coreNode.Close(); err != nil {
+			logging.GetLogger().Warnf("cannot close core node: %v", err)
 		}
+	}()
+	coreService := corepb.NewCoreServiceClient(coreNode)
+	resp, err := coreService.LastBlockHeight(ctx, req)
+	if err != nil {
+		log.Printf("couldn't get last block: %v\n", err)
+		return nil
 	}
+	return resp
 }
 
-func (a *Authenticator) getProofOfWork() *ProofOfWork {
-	powList := make([]*ProofOfWork, 0)
-	for _, height := range maps.Keys(a.powByBlock) {
-		for _, pow := range a.powByBlock[height] {
-			if !pow.Used {
-				powList = append(powList, pow)
-			}
-		}
+// getSpamStatistics returns the PoW spam statistics Vega holds for the party, or nil if they cannot be fetched, in
+// which case the PoW pool falls back to its own count of the party's transactions. They are fetched once per party
+// per block, since within a block the pool's own count covers the transactions sent since.
+func (a *Authenticator) getSpamStatistics(
+	ctx context.Context,
+	partyId string,
+	blockHeight uint64,
+) *corepb.PoWStatistic {
+	a.spamStatsLock.Lock()
+	entry := a.spamStats[partyId]
+	a.spamStatsLock.Unlock()
+	if entry != nil && entry.blockHeight == blockHeight {
+		return entry.stats
 	}
-	// FIXME: We should fetch the latest spam properties for the pub key that intends to use this PoW from Vega
-	sort.Slice(powList, func(i, j int) bool {
-		if powList[i].BlockHeight == powList[j].BlockHeight {
-			return powList[i].Difficulty < powList[j].Difficulty
-		}
-		return powList[i].BlockHeight < powList[j].BlockHeight
-	})
-	if len(powList) == 0 {
+	stats := a.fetchSpamStatistics(ctx, partyId)
+	if stats == nil {
 		return nil
-	} else {
-		pow := powList[0]
-		a.taintProofOfWork(pow.BlockHeight, pow.TxId)
-		return pow
 	}
+	a.spamStatsLock.Lock()
+	a.spamStats[partyId] = &spamStatsEntry{blockHeight: blockHeight, stats: stats}
+	a.spamStatsLock.Unlock()
+	return stats
 }
 
-func (a *Authenticator) getLastBlock() *corepb.LastBlockHeightResponse {
-	req := &corepb.LastBlockHeightRequest{}
-	coreNode, _ := grpc.Dial(a.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	coreService := corepb.NewCoreServiceClient(coreNode)
-	resp, err := coreService.LastBlockHeight(context.Background(), req)
+// GetBannedUntil returns when the party's spam ban ends, or false if Vega does not report one
+func (a *Authenticator) GetBannedUntil(ctx context.Context, partyId string) (time.Time, bool) {
+	stats := a.fetchSpamStatistics(ctx, partyId)
+	if stats == nil || stats.BannedUntil == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, *stats.BannedUntil), true
+}
+
+func (a *Authenticator) fetchSpamStatistics(ctx context.Context, partyId string) *corepb.PoWStatistic {
+	req := &corepb.GetSpamStatisticsRequest{PartyId: partyId}
+	coreNode, err := grpc.Dial(a.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		log.Printf("couldn't get last block: %v\n", err)
+		logging.GetLogger().Warnf("could not get spam statistics: %v", err)
 		return nil
 	}
-	err = coreNode.Close()
+	defer coreNode.Close()
+	coreService := corepb.NewCoreServiceClient(coreNode)
+	resp, err := coreService.GetSpamStatistics(ctx, req)
 	if err != nil {
-		logging.GetLogger().Warnf("cannot close core node: %v", err)
+		logging.GetLogger().Warnf("could not get spam statistics: %v", err)
+		return nil
 	}
-	return resp
+	if resp.Statistics == nil {
+		return nil
+	}
+	return resp.Statistics.Pow
 }
 
+// buildTx waits for the PoW pool to have a PoW the key can use, until ctx is done, so a pool that has run dry
+// never stalls the caller indefinitely
 func (a *Authenticator) buildTx(
-	keyPair *store.KeyPair,
+	ctx context.Context,
+	publicKey string,
 	lastBlock *corepb.LastBlockHeightResponse,
 	inputData *commandspb.InputData,
-) *commandspb.Transaction {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	var pow *ProofOfWork
-	for range time.NewTicker(time.Second).C {
-		pow = a.getProofOfWork()
-		if pow != nil {
-			break
+) (*commandspb.Transaction, error) {
+	stats := a.getSpamStatistics(ctx, publicKey, lastBlock.Height)
+	if stats != nil && stats.BannedUntil != nil && time.Now().Before(time.Unix(0, *stats.BannedUntil)) {
+		return nil, fmt.Errorf("%s is banned until %s", publicKey,
+			time.Unix(0, *stats.BannedUntil).UTC().Format(time.RFC3339))
+	}
+	pow := a.powPool.Take(publicKey, stats)
+	if pow == nil {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for pow == nil {
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w for %s: %v", ErrNoProofOfWork, publicKey, ctx.Err())
+			case <-ticker.C:
+				pow = a.powPool.Take(publicKey, stats)
+			}
 		}
 	}
 	inputData.BlockHeight = pow.BlockHeight
@@ -248,11 +212,14 @@ func (a *Authenticator) buildTx(
 		[]byte("\u0000"),
 		inputDataBytes,
 	}, []byte{})
-	hexSig := a.signInputData(keyPair.PrivateKey, inputDataPacked)
+	sig, err := a.signer.Sign(publicKey, inputDataPacked)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign transaction for %s: %v", publicKey, err)
+	}
 	signature := &commandspb.Signature{
 		Algo:    "vega/ed25519",
 		Version: 1,
-		Value:   hexSig,
+		Value:   hex.EncodeToString(sig),
 	}
 	proofOfWork := &commandspb.ProofOfWork{Tid: pow.TxId, Nonce: pow.Nonce}
 	tx := &commandspb.Transaction{
@@ -260,53 +227,83 @@ func (a *Authenticator) buildTx(
 		Signature: signature,
 		Pow:       proofOfWork,
 		InputData: inputDataBytes,
-		From:      &commandspb.Transaction_PubKey{PubKey: keyPair.PublicKey},
+		From:      &commandspb.Transaction_PubKey{PubKey: publicKey},
 	}
-	return tx
+	return tx, nil
 }
 
-func (a *Authenticator) signInputData(privateKey string, inputDataPacked []byte) string {
-	hash := sha3.Sum256(inputDataPacked)
-	if len(privateKey) > 64 {
-		privateKey = privateKey[0:64]
+// Sign returns ErrNoProofOfWork if no usable PoW turns up before ctx is done. It is up to the caller whether to
+// retry or drop the transaction.
+func (a *Authenticator) Sign(
+	ctx context.Context,
+	partyId string,
+	inputData *commandspb.InputData,
+) (*commandspb.Transaction, error) {
+	if transactionSigner, ok := a.signer.(TransactionSigner); ok {
+		command, err := marshalCommand(inputData)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode transaction for %s: %v", partyId, err)
+		}
+		return transactionSigner.SignTransaction(ctx, partyId, command)
 	}
-	key, _ := hex.DecodeString(privateKey)
-	sig := ed25519.Sign(ed25519.NewKeyFromSeed(key), hash[:])
-	return hex.EncodeToString(sig)
-}
-
-func (a *Authenticator) Sign(partyId string, inputData *commandspb.InputData) *commandspb.Transaction {
-	lastBlock := a.getLastBlock()
+	lastBlock := a.getLastBlock(ctx)
 	if lastBlock == nil {
-		return nil
+		return nil, errors.New("cannot get last block")
 	}
 	inputData.BlockHeight = lastBlock.Height
 	inputData.Nonce = rand.Uint64()
-	keyPair, err := a.wallet.GetByPublicKey(partyId)
+	return a.buildTx(ctx, partyId, lastBlock, inputData)
+}
+
+// marshalCommand encodes the command held in the input data as the wallet expects it, for example
+// {"orderSubmission": {...}}. The nonce and block height are left for the wallet to set.
+func marshalCommand(inputData *commandspb.InputData) (json.RawMessage, error) {
+	encoded, err := protojson.Marshal(inputData)
 	if err != nil {
-		log.Printf("%v\n", err)
-		return nil
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(encoded, &fields)
+	if err != nil {
+		return nil, err
 	}
-	return a.buildTx(keyPair, lastBlock, inputData)
+	delete(fields, "nonce")
+	delete(fields, "blockHeight")
+	return json.Marshal(fields)
 }
 
-func (a *Authenticator) SubmitTx(tx *commandspb.Transaction) *corepb.SubmitTransactionResponse {
+func (a *Authenticator) SubmitTx(
+	ctx context.Context,
+	tx *commandspb.Transaction,
+) (*corepb.SubmitTransactionResponse, error) {
 	req := &corepb.SubmitTransactionRequest{Tx: tx}
-	coreNode, _ := grpc.Dial(a.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	coreService := corepb.NewCoreServiceClient(coreNode)
-	resp, err := coreService.SubmitTransaction(context.Background(), req)
+	coreNode, err := grpc.Dial(a.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		log.Printf("couldn't submit tx: %v\n", err)
-	} else if !resp.Success {
-		log.Printf("tx = %s; code = %d; data = %s\n", resp.TxHash, resp.Code, resp.Data)
+		return nil, fmt.Errorf("couldn't submit tx: %w", err)
 	}
+	coreService := corepb.NewCoreServiceClient(coreNode)
+	resp, submitErr := coreService.SubmitTransaction(ctx, req)
+	record := &journal.TransactionRecord{PubKey: tx.GetPubKey(), Tid: tx.GetPow().GetTid()}
+	if submitErr != nil {
+		log.Printf("couldn't submit tx: %v\n", submitErr)
+		record.Error = submitErr.Error()
+	} else {
+		if !resp.Success {
+			log.Printf("tx = %s; code = %d; data = %s\n", resp.TxHash, resp.Code, resp.Data)
+		}
+		record.TxHash = resp.TxHash
+		record.Success = resp.Success
+		record.Code = resp.Code
+		record.Data = resp.Data
+	}
+	a.journal.Record(journal.Transaction, record)
 	err = coreNode.Close()
 	if err != nil {
 		logging.GetLogger().Errorf("cannot close core node: %v", err)
 	}
-	return resp
+	return resp, submitErr
 }
 
-func (a *Authenticator) GetWallet() *Wallet {
-	return a.wallet
+func (a *Authenticator) GetSigner() Signer {
+	return a.signer
 }
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"github.com/sasha-s/go-deadlock"
+	"os"
+	"strings"
+	"vega-cli-mm/store"
+)
+
+// KeySigner signs with a fixed list of raw ed25519 private keys, addressed by their position in the list. It backs
+// the hex key file and gives tests a deterministic signer.
+type KeySigner struct {
+	mu          deadlock.RWMutex
+	keys        []*store.KeyPair
+	privateKeys map[string]ed25519.PrivateKey
+	closed      bool
+}
+
+// NewKeySigner accepts hex encoded private keys, either the 32 byte seed or the 64 byte seed and public key
+func NewKeySigner(privateKeys []string) (*KeySigner, error) {
+	signer := &KeySigner{
+		keys:        make([]*store.KeyPair, 0, len(privateKeys)),
+		privateKeys: map[string]ed25519.PrivateKey{},
+	}
+	for i, privateKey := range privateKeys {
+		privateKey = strings.ToLower(strings.TrimSpace(privateKey))
+		decoded, err := hex.DecodeString(privateKey)
+		if err != nil || (len(decoded) != ed25519.SeedSize && len(decoded) != ed25519.PrivateKeySize) {
+			Zero(decoded)
+			signer.Close()
+			return nil, fmt.Errorf("key %d is not a hex encoded ed25519 private key", i)
+		}
+		fullKey := ed25519.NewKeyFromSeed(decoded[:ed25519.SeedSize])
+		mismatched := len(decoded) == ed25519.PrivateKeySize && !bytes.Equal(decoded, fullKey)
+		Zero(decoded)
+		if mismatched {
+			Zero(fullKey)
+			signer.Close()
+			return nil, fmt.Errorf("key %d has a public key that does not match its seed", i)
+		}
+		keyPair := store.NewKeyPair(hex.EncodeToString(fullKey.Public().(ed25519.PublicKey)))
+		signer.keys = append(signer.keys, keyPair)
+		signer.privateKeys[keyPair.PublicKey] = fullKey
+	}
+	return signer, nil
+}
+
+// LoadKeySigner reads one hex private key per line. Blank lines and lines starting with # are skipped.
+func LoadKeySigner(path string) (*KeySigner, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	defer file.Close()
+	privateKeys := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		privateKeys = append(privateKeys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	signer, err := NewKeySigner(privateKeys)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	return signer, nil
+}
+
+func (k *KeySigner) GetKey(idx uint) (*store.KeyPair, error) {
+	if idx >= uint(len(k.keys)) {
+		return nil, fmt.Errorf("only %d key(s) available, cannot use key %d", len(k.keys), idx)
+	}
+	return k.keys[idx], nil
+}
+
+func (k *KeySigner) Keys() (map[uint]*store.KeyPair, error) {
+	keys := make(map[uint]*store.KeyPair, len(k.keys))
+	for idx, keyPair := range k.keys {
+		keys[uint(idx)] = keyPair
+	}
+	return keys, nil
+}
+
+func (k *KeySigner) Sign(publicKey string, data []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.closed {
+		return nil, ErrSignerClosed
+	}
+	privateKey := k.privateKeys[strings.ToLower(publicKey)]
+	if privateKey == nil {
+		return nil, fmt.Errorf("cannot find key pair for pub key %s", publicKey)
+	}
+	return signEd25519(privateKey, data), nil
+}
+
+// Close zeroes every private key. The signer cannot sign afterwards.
+func (k *KeySigner) Close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.closed = true
+	for publicKey, privateKey := range k.privateKeys {
+		Zero(privateKey)
+		delete(k.privateKeys, publicKey)
+	}
+}
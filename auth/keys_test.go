@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/sha3"
+	"testing"
+)
+
+// the first test vector of RFC 8032
+const (
+	testSeed      = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+	testPublicKey = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	// the signature of the SHA3-256 hash of "vega", as Vega transactions are signed
+	testSignature = "98444ec80e0ff3f99a4ada4da062795c69e984623b5995fd56873cf315fa52c1" +
+		"e0314aba60705172c0951f0b9f6bfac410db50797e8843b9d4d9674c9e48bf0b"
+)
+
+func TestNewKeySignerAcceptsSeedAndFullKey(t *testing.T) {
+	signer, err := NewKeySigner([]string{testSeed, " " + testSeed + testPublicKey + "\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	for idx := uint(0); idx < 2; idx++ {
+		keyPair, err := signer.GetKey(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyPair.PublicKey != testPublicKey {
+			t.Fatalf("expected key %d to be %s, got %s", idx, testPublicKey, keyPair.PublicKey)
+		}
+	}
+	if _, err = signer.GetKey(2); err == nil {
+		t.Fatal("expected an error for a key outside the list")
+	}
+}
+
+func TestNewKeySignerRejectsInvalidKeys(t *testing.T) {
+	otherPublicKey := hex.EncodeToString(make([]byte, ed25519.PublicKeySize))
+	for name, privateKey := range map[string]string{
+		"mismatched public key": testSeed + otherPublicKey,
+		"wrong length":          testSeed[:62],
+		"not hex":               "zz" + testSeed[2:],
+	} {
+		if _, err := NewKeySigner([]string{privateKey}); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestKeySignerSignsKnownVector(t *testing.T) {
+	signer, err := NewKeySigner([]string{testSeed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.Sign(testPublicKey, []byte("vega"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(sig) != testSignature {
+		t.Fatalf("unexpected signature %x", sig)
+	}
+	publicKey, _ := hex.DecodeString(testPublicKey)
+	hash := sha3.Sum256([]byte("vega"))
+	if !ed25519.Verify(publicKey, hash[:], sig) {
+		t.Fatal("signature does not verify against the public key")
+	}
+	signer.Close()
+	if _, err = signer.Sign(testPublicKey, []byte("vega")); !errors.Is(err, ErrSignerClosed) {
+		t.Fatalf("expected a closed signer to refuse to sign, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"os"
+	"path/filepath"
+)
+
+const KeystoreVersion = 1
+const ScryptN = 1 << 15
+const ScryptR = 8
+const ScryptP = 1
+const keyLength = 32
+const saltLength = 32
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted keystore")
+
+type ScryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+// Keystore holds a secret encrypted with AES-256-GCM under a key derived from a passphrase with scrypt
+type Keystore struct {
+	Version    int          `json:"version"`
+	Kdf        string       `json:"kdf"`
+	KdfParams  ScryptParams `json:"kdfParams"`
+	Cipher     string       `json:"cipher"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+func EncryptKeystore(secret []byte, passphrase []byte) (*Keystore, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %v", err)
+	}
+	params := ScryptParams{N: ScryptN, R: ScryptR, P: ScryptP, Salt: hex.EncodeToString(salt)}
+	aead, err := newAead(passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %v", err)
+	}
+	return &Keystore{
+		Version:    KeystoreVersion,
+		Kdf:        "scrypt",
+		KdfParams:  params,
+		Cipher:     "aes-256-gcm",
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, secret, nil)),
+	}, nil
+}
+
+func (k *Keystore) Decrypt(passphrase []byte) ([]byte, error) {
+	if k.Version != KeystoreVersion || k.Kdf != "scrypt" || k.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported keystore: version = %d; kdf = %s; cipher = %s",
+			k.Version, k.Kdf, k.Cipher)
+	}
+	aead, err := newAead(passphrase, k.KdfParams)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(k.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid keystore nonce")
+	}
+	ciphertext, err := hex.DecodeString(k.Ciphertext)
+	if err != nil {
+		return nil, errors.New("invalid keystore ciphertext")
+	}
+	secret, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return secret, nil
+}
+
+func newAead(passphrase []byte, params ScryptParams) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, errors.New("invalid keystore salt")
+	}
+	key, err := scrypt.Key(passphrase, salt, params.N, params.R, params.P, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("cannot derive keystore key: %v", err)
+	}
+	defer Zero(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func LoadKeystore(path string) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	var keystore Keystore
+	err = json.Unmarshal(data, &keystore)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	return &keystore, nil
+}
+
+// SaveKeystore writes the keystore readable only by the current user. An existing file is never overwritten, so
+// that a mistyped command cannot destroy the only copy of a wallet.
+func SaveKeystore(path string, keystore *Keystore) error {
+	data, err := json.MarshalIndent(keystore, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Zero overwrites secret material so that it does not linger in memory
+func Zero(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+)
+
+// PassphraseSource says where the keystore passphrase comes from. A file descriptor takes precedence over the
+// environment variable, and when neither is available the passphrase is read from the terminal.
+type PassphraseSource struct {
+	Env string
+	Fd  int
+}
+
+// Read returns the passphrase. With confirm set, as when a keystore is created, an empty passphrase is refused
+// whichever source it comes from.
+func (s PassphraseSource) Read(confirm bool) ([]byte, error) {
+	var passphrase []byte
+	var err error
+	if s.Fd >= 0 {
+		passphrase, err = readPassphraseFd(s.Fd)
+	} else if value, ok := os.LookupEnv(s.Env); len(s.Env) > 0 && ok {
+		passphrase = []byte(value)
+	} else {
+		return promptPassphrase(confirm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if confirm && len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	return passphrase, nil
+}
+
+func readPassphraseFd(fd int) ([]byte, error) {
+	file := os.NewFile(uintptr(fd), "passphrase")
+	if file == nil {
+		return nil, fmt.Errorf("invalid passphrase file descriptor %d", fd)
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("cannot read passphrase from file descriptor %d: %v", fd, err)
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+func promptPassphrase(confirm bool) ([]byte, error) {
+	passphrase, err := ReadSecretLine("Keystore passphrase: ")
+	if err != nil {
+		return nil, fmt.Errorf("no passphrase given: %w", err)
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	repeated, err := ReadSecretLine("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(repeated)
+	if !bytes.Equal(passphrase, repeated) {
+		Zero(passphrase)
+		return nil, errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// ReadSecretLine prompts on stderr and reads a line from the terminal without echoing it
+func ReadSecretLine(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read from terminal: %v", err)
+	}
+	return line, nil
+}
@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"code.vegaprotocol.io/vega/libs/crypto"
+	corepb "code.vegaprotocol.io/vega/protos/vega/api/v1"
+	"github.com/google/uuid"
+	"github.com/sasha-s/go-deadlock"
+	"golang.org/x/exp/maps"
+	"math"
+	"strconv"
+	"sync"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/store"
+)
+
+const NumberOfPastBlocksKey = "spam.pow.numberOfPastBlocks"
+const TxPerBlockKey = "spam.pow.numberOfTxPerBlock"
+
+// PowBufferBlocks is how many blocks of transactions, at the observed rate, the pool tries to hold in reserve
+const PowBufferBlocks = 3
+
+// powRateSmoothing weights the latest block when updating the moving average of transactions per block
+const powRateSmoothing = 0.2
+
+type ProofOfWork struct {
+	BlockHash   string
+	BlockHeight uint64
+	Difficulty  uint
+	Nonce       uint64
+	TxId        string
+	Used        bool
+}
+
+func NewProofOfWork(
+	blockHash string,
+	blockHeight uint64,
+	difficulty uint,
+	nonce uint64,
+	txId string,
+	used bool,
+) *ProofOfWork {
+	return &ProofOfWork{
+		BlockHash:   blockHash,
+		BlockHeight: blockHeight,
+		Difficulty:  difficulty,
+		Nonce:       nonce,
+		TxId:        txId,
+		Used:        used,
+	}
+}
+
+// PowPool pre-computes proofs of work ahead of demand. Vega counts transactions per key against the block each PoW
+// was computed for, and every spam.pow.numberOfTxPerBlock transactions beyond the first batch raise the difficulty
+// that key needs for that block by one, so the pool tracks that usage to hand each key the cheapest PoW it can use.
+type PowPool struct {
+	mu             deadlock.RWMutex
+	store          *store.Store
+	powByBlock     map[uint64][]*ProofOfWork
+	baseDifficulty map[uint64]uint
+	usageByBlock   map[uint64]map[string]uint
+	lastHeight     uint64
+	usedSinceLast  uint
+	txRate         float64
+}
+
+func NewPowPool(
+	store *store.Store,
+) *PowPool {
+	return &PowPool{
+		store:          store,
+		powByBlock:     map[uint64][]*ProofOfWork{},
+		baseDifficulty: map[uint64]uint{},
+		usageByBlock:   map[uint64]map[string]uint{},
+	}
+}
+
+// Refill runs once per new block. It updates the observed transaction rate and computes enough PoW for the new
+// block to bring the pool back up to its target depth.
+func (p *PowPool) Refill(lastBlock *corepb.LastBlockHeightResponse) {
+	txPerBlock, ok := p.getTxPerBlock()
+	if !ok {
+		return
+	}
+	keyCount := p.getKeyCount()
+	p.mu.Lock()
+	if lastBlock.Height <= p.lastHeight {
+		p.mu.Unlock()
+		return
+	}
+	if p.lastHeight > 0 {
+		observed := float64(p.usedSinceLast) / float64(lastBlock.Height-p.lastHeight)
+		p.txRate = powRateSmoothing*observed + (1-powRateSmoothing)*p.txRate
+	}
+	p.lastHeight = lastBlock.Height
+	p.usedSinceLast = 0
+	target := p.getTargetDepth(keyCount)
+	needed := target - p.getDepth()
+	// Anything beyond one step of escalation per key is left for the next block, where it is cheaper
+	maxPerBlock := keyCount * int(txPerBlock) * 2
+	if needed > maxPerBlock {
+		needed = maxPerBlock
+	}
+	if needed <= 0 {
+		p.mu.Unlock()
+		p.saveStats(lastBlock.Height, keyCount)
+		return
+	}
+	baseDifficulty := uint(lastBlock.GetSpamPowDifficulty())
+	p.baseDifficulty[lastBlock.Height] = baseDifficulty
+	p.mu.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < needed; i++ {
+		wg.Add(1)
+		// PoWs are dealt round-robin to the keys, so the i-th one is that key's (i / keyCount)-th for this block
+		difficulty := baseDifficulty + uint(math.Floor(float64(i/keyCount)/txPerBlock))
+		go func() {
+			defer wg.Done()
+			txId, _ := uuid.NewRandom()
+			nonce, _, err := crypto.PoW(lastBlock.Hash, txId.String(), difficulty, lastBlock.SpamPowHashFunction)
+			if err != nil {
+				logging.GetLogger().Warnf("cannot compute pow: %v", err)
+				return
+			}
+			pow := NewProofOfWork(lastBlock.Hash, lastBlock.Height, difficulty, nonce, txId.String(), false)
+			p.mu.Lock()
+			p.powByBlock[lastBlock.Height] = append(p.powByBlock[lastBlock.Height], pow)
+			p.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	logging.GetLogger().Debugf("computed %d pow for block %d", needed, lastBlock.Height)
+	p.saveStats(lastBlock.Height, keyCount)
+}
+
+// Prune drops PoW, and the usage counted against it, for blocks that will soon be too old for Vega to accept
+func (p *PowPool) Prune(lastBlock *corepb.LastBlockHeightResponse) {
+	numberOfPastBlocksParam := p.store.GetNetworkParameter(NumberOfPastBlocksKey)
+	if numberOfPastBlocksParam == nil {
+		logging.GetLogger().Warnf("cannot get network parameter: %s", NumberOfPastBlocksKey)
+		return
+	}
+	numberOfPastBlocks, err := strconv.ParseFloat(numberOfPastBlocksParam.Value, 0)
+	if err != nil {
+		logging.GetLogger().Warnf("cannot get network parameter: %s", NumberOfPastBlocksKey)
+		return
+	}
+	window := uint64(math.Round(0.8 * numberOfPastBlocks))
+	if lastBlock.Height < window {
+		// early in the chain no block is old enough to drop, and the subtraction below would wrap around
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	oldestBlock := lastBlock.Height - window
+	for _, height := range maps.Keys(p.powByBlock) {
+		if height <= oldestBlock {
+			delete(p.powByBlock, height)
+		}
+	}
+	for _, height := range maps.Keys(p.usageByBlock) {
+		if height <= oldestBlock {
+			delete(p.usageByBlock, height)
+			delete(p.baseDifficulty, height)
+		}
+	}
+}
+
+// Take hands out the unused PoW that needs the least extra difficulty for publicKey, preferring older blocks, and
+// counts it against that key for the PoW's block. When the key's spam statistics from Vega are given they take
+// precedence over the pool's own count wherever they ask for more, and blocks Vega will no longer accept
+// transactions from the key for are skipped.
+func (p *PowPool) Take(publicKey string, stats *corepb.PoWStatistic) *ProofOfWork {
+	txPerBlock, ok := p.getTxPerBlock()
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	networkRequired := map[uint64]uint{}
+	exhausted := map[uint64]bool{}
+	if stats != nil {
+		for _, state := range stats.BlockStates {
+			p.recordUsage(state.BlockHeight, publicKey, uint(state.TransactionsSeen))
+			if state.ExpectedDifficulty == nil {
+				exhausted[state.BlockHeight] = true
+			} else {
+				networkRequired[state.BlockHeight] = uint(*state.ExpectedDifficulty)
+			}
+		}
+	}
+	var best *ProofOfWork
+	var bestExcess uint
+	for _, height := range maps.Keys(p.powByBlock) {
+		if exhausted[height] {
+			continue
+		}
+		required := p.requiredDifficulty(height, publicKey, txPerBlock)
+		if networkRequired[height] > required {
+			required = networkRequired[height]
+		}
+		for _, pow := range p.powByBlock[height] {
+			if pow.Used || pow.Difficulty < required {
+				continue
+			}
+			excess := pow.Difficulty - required
+			if best == nil || excess < bestExcess || (excess == bestExcess && pow.BlockHeight < best.BlockHeight) {
+				best = pow
+				bestExcess = excess
+			}
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.Used = true
+	p.recordUsage(best.BlockHeight, publicKey, p.usageByBlock[best.BlockHeight][publicKey]+1)
+	p.usedSinceLast++
+	return best
+}
+
+// recordUsage must be called with the lock held. The count never goes down, since Vega may not yet have seen
+// transactions that were sent moments ago.
+func (p *PowPool) recordUsage(height uint64, publicKey string, count uint) {
+	if p.usageByBlock[height] == nil {
+		p.usageByBlock[height] = map[string]uint{}
+	}
+	if count > p.usageByBlock[height][publicKey] {
+		p.usageByBlock[height][publicKey] = count
+	}
+}
+
+func (p *PowPool) Depth() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.getDepth()
+}
+
+// requiredDifficulty must be called with the lock held
+func (p *PowPool) requiredDifficulty(height uint64, publicKey string, txPerBlock float64) uint {
+	used := p.usageByBlock[height][publicKey]
+	return p.baseDifficulty[height] + uint(math.Floor(float64(used)/txPerBlock))
+}
+
+// getDepth must be called with the lock held
+func (p *PowPool) getDepth() int {
+	depth := 0
+	for _, powList := range p.powByBlock {
+		for _, pow := range powList {
+			if !pow.Used {
+				depth++
+			}
+		}
+	}
+	return depth
+}
+
+// getTargetDepth must be called with the lock held. Every key gets at least one PoW so that none has to wait.
+func (p *PowPool) getTargetDepth(keyCount int) int {
+	target := int(math.Ceil(p.txRate * PowBufferBlocks))
+	if target < keyCount {
+		target = keyCount
+	}
+	return target
+}
+
+func (p *PowPool) getTxPerBlock() (float64, bool) {
+	txPerBlockParam := p.store.GetNetworkParameter(TxPerBlockKey)
+	if txPerBlockParam == nil {
+		logging.GetLogger().Warnf("cannot get network parameter: %s", TxPerBlockKey)
+		return 0, false
+	}
+	txPerBlock, err := strconv.ParseFloat(txPerBlockParam.Value, 0)
+	if err != nil || txPerBlock < 1 {
+		logging.GetLogger().Warnf("cannot get network parameter: %s", TxPerBlockKey)
+		return 0, false
+	}
+	return txPerBlock, true
+}
+
+func (p *PowPool) getKeyCount() int {
+	keys := map[string]bool{}
+	for _, config := range p.store.GetMarketConfig() {
+		if config.KeyPair != nil {
+			keys[config.KeyPair.PublicKey] = true
+		}
+	}
+	if len(keys) == 0 {
+		return 1
+	}
+	return len(keys)
+}
+
+func (p *PowPool) saveStats(blockHeight uint64, keyCount int) {
+	p.mu.RLock()
+	stats := &store.PowStats{
+		BlockHeight:       blockHeight,
+		Depth:             p.getDepth(),
+		TargetDepth:       p.getTargetDepth(keyCount),
+		TxPerBlock:        p.txRate,
+		KeyCount:          keyCount,
+		DepthByDifficulty: map[uint]int{},
+		TxByKey:           map[string]uint{},
+	}
+	for _, powList := range p.powByBlock {
+		for _, pow := range powList {
+			if !pow.Used {
+				stats.DepthByDifficulty[pow.Difficulty]++
+			}
+		}
+	}
+	for _, usage := range p.usageByBlock {
+		for publicKey, count := range usage {
+			stats.TxByKey[publicKey] += count
+		}
+	}
+	p.mu.RUnlock()
+	p.store.SavePowStats(stats)
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	corepb "code.vegaprotocol.io/vega/protos/vega/api/v1"
+	"testing"
+	"vega-cli-mm/store"
+)
+
+func TestPruneKeepsRecentBlocks(t *testing.T) {
+	s := store.NewStore()
+	s.SaveNetworkParameter(&vegapb.NetworkParameter{Key: NumberOfPastBlocksKey, Value: "100"})
+	pool := NewPowPool(s)
+	for _, height := range []uint64{10, 50, 90} {
+		pool.powByBlock[height] = []*ProofOfWork{NewProofOfWork("hash", height, 1, 0, "tid", false)}
+		pool.usageByBlock[height] = map[string]uint{"key": 1}
+	}
+	// below the 80 block window, so nothing can be old enough to drop
+	pool.Prune(&corepb.LastBlockHeightResponse{Height: 60})
+	if len(pool.powByBlock) != 3 || len(pool.usageByBlock) != 3 {
+		t.Fatalf("expected every block to be kept, got %d", len(pool.powByBlock))
+	}
+	pool.Prune(&corepb.LastBlockHeightResponse{Height: 120})
+	if _, ok := pool.powByBlock[10]; ok || len(pool.powByBlock) != 2 || len(pool.usageByBlock) != 2 {
+		t.Fatalf("expected only block 10 to be dropped, got %d blocks", len(pool.powByBlock))
+	}
+}
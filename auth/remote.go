@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"bytes"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sasha-s/go-deadlock"
+	"net/http"
+	"strconv"
+	"time"
+	"vega-cli-mm/store"
+)
+
+type rpcRequest struct {
+	JsonRpc string      `json:"jsonrpc"`
+	Id      string      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type remoteKey struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"publicKey"`
+}
+
+// remoteTransaction is a transaction as returned by client.sign_transaction
+type remoteTransaction struct {
+	InputData string `json:"inputData"`
+	Signature struct {
+		Value   string `json:"value"`
+		Algo    string `json:"algo"`
+		Version uint32 `json:"version"`
+	} `json:"signature"`
+	From struct {
+		PubKey string `json:"pubKey"`
+	} `json:"from"`
+	Pow struct {
+		Tid   string      `json:"tid"`
+		Nonce json.Number `json:"nonce"`
+	} `json:"pow"`
+}
+
+var ErrRawSigningUnsupported = errors.New("the wallet service only signs whole transactions")
+
+// RemoteSigner delegates signing to a Vega wallet service over its client JSON-RPC API, authenticated with a
+// long-living API token, so that private keys never enter this process. The wallet builds, signs and computes the
+// proof of work for each transaction itself. The keys the token can use are listed once and then addressed by
+// their position in that list.
+type RemoteSigner struct {
+	url      string
+	wallet   string
+	token    string
+	client   *http.Client
+	keysLock deadlock.RWMutex
+	keys     []string
+}
+
+func NewRemoteSigner(
+	url string,
+	wallet string,
+	token string,
+	timeout time.Duration,
+) *RemoteSigner {
+	return &RemoteSigner{
+		url:    url,
+		wallet: wallet,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (r *RemoteSigner) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(&rpcRequest{JsonRpc: "2.0", Id: "1", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(r.token) > 0 {
+		req.Header.Set("Authorization", "VWT "+r.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	var rpcResp rpcResponse
+	err = json.NewDecoder(resp.Body).Decode(&rpcResp)
+	if err != nil {
+		return fmt.Errorf("%s failed: status = %s; %v", method, resp.Status, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("%s failed: code = %d; message = %s; data = %s",
+			method, rpcResp.Error.Code, rpcResp.Error.Message, rpcResp.Error.Data)
+	}
+	return json.Unmarshal(rpcResp.Result, result)
+}
+
+func (r *RemoteSigner) listKeys() ([]string, error) {
+	r.keysLock.Lock()
+	defer r.keysLock.Unlock()
+	if r.keys != nil {
+		return r.keys, nil
+	}
+	var result struct {
+		Keys []*remoteKey `json:"keys"`
+	}
+	err := r.call(context.Background(), "client.list_keys", map[string]string{}, &result)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(result.Keys))
+	for _, key := range result.Keys {
+		keys = append(keys, key.PublicKey)
+	}
+	r.keys = keys
+	return r.keys, nil
+}
+
+func (r *RemoteSigner) Keys() (map[uint]*store.KeyPair, error) {
+	publicKeys, err := r.listKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[uint]*store.KeyPair, len(publicKeys))
+	for idx, publicKey := range publicKeys {
+		keys[uint(idx)] = store.NewKeyPair(publicKey)
+	}
+	return keys, nil
+}
+
+func (r *RemoteSigner) GetKey(idx uint) (*store.KeyPair, error) {
+	keys, err := r.listKeys()
+	if err != nil {
+		return nil, err
+	}
+	if idx >= uint(len(keys)) {
+		return nil, fmt.Errorf("wallet %s has %d key(s), cannot use key %d", r.wallet, len(keys), idx)
+	}
+	return store.NewKeyPair(keys[idx]), nil
+}
+
+// Close has nothing to zero, the keys never leave the wallet service
+func (r *RemoteSigner) Close() {}
+
+// Sign always fails, the client API has no way to sign arbitrary data. Transactions go through SignTransaction.
+func (r *RemoteSigner) Sign(publicKey string, data []byte) ([]byte, error) {
+	return nil, ErrRawSigningUnsupported
+}
+
+func (r *RemoteSigner) SignTransaction(
+	ctx context.Context,
+	publicKey string,
+	command json.RawMessage,
+) (*commandspb.Transaction, error) {
+	params := map[string]interface{}{
+		"publicKey":   publicKey,
+		"transaction": command,
+	}
+	var result struct {
+		Transaction *remoteTransaction `json:"transaction"`
+	}
+	err := r.call(ctx, "client.sign_transaction", params, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Transaction == nil {
+		return nil, errors.New("client.sign_transaction returned no transaction")
+	}
+	signed := result.Transaction
+	inputData, err := base64.StdEncoding.DecodeString(signed.InputData)
+	if err != nil {
+		return nil, fmt.Errorf("client.sign_transaction returned invalid input data: %v", err)
+	}
+	if _, err = hex.DecodeString(signed.Signature.Value); err != nil {
+		return nil, fmt.Errorf("client.sign_transaction returned an invalid signature: %v", err)
+	}
+	nonce, err := strconv.ParseUint(signed.Pow.Nonce.String(), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("client.sign_transaction returned an invalid proof of work nonce: %v", err)
+	}
+	return &commandspb.Transaction{
+		Version: commandspb.TxVersion_TX_VERSION_V3,
+		Signature: &commandspb.Signature{
+			Algo:    signed.Signature.Algo,
+			Version: signed.Signature.Version,
+			Value:   signed.Signature.Value,
+		},
+		Pow:       &commandspb.ProofOfWork{Tid: signed.Pow.Tid, Nonce: nonce},
+		InputData: inputData,
+		From:      &commandspb.Transaction_PubKey{PubKey: signed.From.PubKey},
+	}, nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newWalletService stubs the client API of a Vega wallet service holding two keys
+func newWalletService(t *testing.T, methods *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "VWT token-1" {
+			t.Errorf("unexpected authorization header %q", r.Header.Get("Authorization"))
+		}
+		var req struct {
+			Method string                     `json:"method"`
+			Params map[string]json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("could not decode request: %v", err)
+		}
+		*methods = append(*methods, req.Method)
+		var result string
+		switch req.Method {
+		case "client.list_keys":
+			result = `{"keys": [{"name": "a", "publicKey": "key-0"}, {"name": "b", "publicKey": "key-1"}]}`
+		case "client.sign_transaction":
+			if string(req.Params["publicKey"]) != `"key-1"` {
+				t.Errorf("unexpected public key %s", req.Params["publicKey"])
+			}
+			if string(req.Params["transaction"]) != `{"orderCancellation":{"marketId":"market-1"}}` {
+				t.Errorf("unexpected transaction %s", req.Params["transaction"])
+			}
+			result = `{"transaction": {
+				"inputData": "` + base64.StdEncoding.EncodeToString([]byte("input")) + `",
+				"signature": {"value": "abcd", "algo": "vega/ed25519", "version": 1},
+				"from": {"pubKey": "key-1"},
+				"version": 3,
+				"pow": {"tid": "tid-1", "nonce": "42"}
+			}}`
+		default:
+			_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": "1", "error": {"code": -32601, "message": "Method not found"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": "1", "result": ` + result + `}`))
+	}))
+}
+
+func TestRemoteSignerListsKeysOnce(t *testing.T) {
+	var methods []string
+	server := newWalletService(t, &methods)
+	defer server.Close()
+	signer := NewRemoteSigner(server.URL, "wallet-1", "token-1", time.Second)
+	keyPair, err := signer.GetKey(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyPair.PublicKey != "key-1" {
+		t.Fatalf("expected key-1, got %s", keyPair.PublicKey)
+	}
+	if _, err = signer.GetKey(2); err == nil {
+		t.Fatal("expected an error for a key the wallet does not hold")
+	}
+	keys, err := signer.Keys()
+	if err != nil || len(keys) != 2 || keys[0].PublicKey != "key-0" {
+		t.Fatalf("expected two keys, got %v: %v", keys, err)
+	}
+	if len(methods) != 1 || methods[0] != "client.list_keys" {
+		t.Fatalf("expected a single client.list_keys call, got %v", methods)
+	}
+}
+
+func TestRemoteSignerSignsTransactions(t *testing.T) {
+	var methods []string
+	server := newWalletService(t, &methods)
+	defer server.Close()
+	signer := NewRemoteSigner(server.URL, "wallet-1", "token-1", time.Second)
+	command := json.RawMessage(`{"orderCancellation":{"marketId":"market-1"}}`)
+	tx, err := signer.SignTransaction(context.Background(), "key-1", command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tx.InputData) != "input" || tx.GetPubKey() != "key-1" {
+		t.Fatalf("unexpected transaction: %+v", tx)
+	}
+	if tx.Signature.Value != "abcd" || tx.Signature.Algo != "vega/ed25519" || tx.Signature.Version != 1 {
+		t.Fatalf("unexpected signature: %+v", tx.Signature)
+	}
+	if tx.Pow.Tid != "tid-1" || tx.Pow.Nonce != 42 {
+		t.Fatalf("unexpected proof of work: %+v", tx.Pow)
+	}
+	if _, err = signer.Sign("key-1", []byte("data")); !errors.Is(err, ErrRawSigningUnsupported) {
+		t.Fatalf("expected raw signing to be refused, got %v", err)
+	}
+	if len(methods) != 1 || methods[0] != "client.sign_transaction" {
+		t.Fatalf("expected a single client.sign_transaction call, got %v", methods)
+	}
+}
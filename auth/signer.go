@@ -0,0 +1,25 @@
+package auth
+
+import (
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	"context"
+	"encoding/json"
+	"vega-cli-mm/store"
+)
+
+// Signer holds the keys the market maker trades with and signs transaction data on their behalf. Keys are addressed
+// by the keyIndex given to each market in the config. A signer that also implements TransactionSigner, such as the
+// remote wallet service, may only sign whole transactions, in which case Sign returns ErrRawSigningUnsupported.
+type Signer interface {
+	GetKey(idx uint) (*store.KeyPair, error)
+	Keys() (map[uint]*store.KeyPair, error)
+	Sign(publicKey string, data []byte) ([]byte, error)
+	Close()
+}
+
+// TransactionSigner is implemented by signers that cannot sign raw data and instead build the whole transaction,
+// including its proof of work, from the command encoded as JSON. The authenticator computes no proof of work of its
+// own for them.
+type TransactionSigner interface {
+	SignTransaction(ctx context.Context, publicKey string, command json.RawMessage) (*commandspb.Transaction, error)
+}
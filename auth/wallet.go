@@ -1,55 +1,178 @@
 package auth
 
 import (
+	"crypto/ed25519"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/sasha-s/go-deadlock"
 	"github.com/tyler-smith/go-bip39"
 	"github.com/vegaprotocol/go-slip10"
+	"golang.org/x/crypto/sha3"
 	"golang.org/x/exp/maps"
-	"log"
 	"strings"
 	"vega-cli-mm/store"
 )
 
+const DefaultDerivationPath = "m/1789'/0'/%d'"
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+var ErrSignerClosed = errors.New("signer is closed")
+
 type Wallet struct {
-	seed        []byte
-	derivedKeys map[uint]*store.KeyPair
+	mu             deadlock.RWMutex
+	seed           []byte
+	derivationPath string
+	derivedKeys    map[uint]*store.KeyPair
+	privateKeys    map[string]ed25519.PrivateKey
+}
+
+// NewWallet checks the mnemonic against the BIP39 word list and checksum before deriving the seed, salted with the
+// optional BIP39 passphrase. The derivation path must contain a single %d, which is replaced with the key index.
+// Keys 0 to keyCount - 1 are derived up front so that they can all be found by public key.
+func NewWallet(mnemonic string, passphrase string, derivationPath string, keyCount uint) (*Wallet, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	err := ValidateDerivationPath(derivationPath)
+	if err != nil {
+		return nil, err
+	}
+	wallet := &Wallet{
+		seed:           bip39.NewSeed(mnemonic, passphrase),
+		derivationPath: derivationPath,
+		derivedKeys:    map[uint]*store.KeyPair{},
+		privateKeys:    map[string]ed25519.PrivateKey{},
+	}
+	for idx := uint(0); idx < keyCount; idx++ {
+		_, err = wallet.derive(idx)
+		if err != nil {
+			wallet.Close()
+			return nil, err
+		}
+	}
+	return wallet, nil
+}
+
+func ValidateDerivationPath(derivationPath string) error {
+	if !strings.HasPrefix(derivationPath, "m/") || strings.Count(derivationPath, "%d") != 1 ||
+		strings.Count(derivationPath, "%") != 1 {
+		return fmt.Errorf("derivation path %q must start with m/ and contain a single %%d for the key index",
+			derivationPath)
+	}
+	_, err := slip10.DeriveForPath(fmt.Sprintf(derivationPath, 0), make([]byte, 64))
+	if err != nil {
+		return fmt.Errorf("invalid derivation path %q: %v", derivationPath, err)
+	}
+	return nil
+}
+
+// LoadWallet decrypts the mnemonic held in the keystore at keystorePath. The decrypted bytes are zeroed once the
+// seed has been derived, but the BIP39 library only accepts the mnemonic as a string, and that copy cannot be wiped.
+// It stays in memory until the garbage collector reuses it.
+func LoadWallet(
+	keystorePath string,
+	keystorePassphrase []byte,
+	bip39Passphrase string,
+	derivationPath string,
+	keyCount uint,
+) (*Wallet, error) {
+	keystore, err := LoadKeystore(keystorePath)
+	if err != nil {
+		return nil, err
+	}
+	mnemonic, err := keystore.Decrypt(keystorePassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %v", keystorePath, err)
+	}
+	defer Zero(mnemonic)
+	wallet, err := NewWallet(string(mnemonic), bip39Passphrase, derivationPath, keyCount)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %v", keystorePath, err)
+	}
+	return wallet, nil
 }
 
-func NewWallet(mnemonic string) *Wallet {
-	if len(mnemonic) == 0 {
-		panic("invalid mnemonic")
+// derive must be called with the lock held
+func (w *Wallet) derive(idx uint) (*store.KeyPair, error) {
+	if keyPair := w.derivedKeys[idx]; keyPair != nil {
+		return keyPair, nil
 	}
-	seed := bip39.NewSeed(mnemonic, "")
-	return &Wallet{
-		seed:        seed,
-		derivedKeys: map[uint]*store.KeyPair{},
+	if w.seed == nil {
+		return nil, ErrSignerClosed
 	}
+	key, err := slip10.DeriveForPath(fmt.Sprintf(w.derivationPath, idx), w.seed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot derive key %d: %v", idx, err)
+	}
+	publicKey, privateKey := key.Keypair()
+	keyPair := store.NewKeyPair(hex.EncodeToString(publicKey))
+	w.derivedKeys[idx] = keyPair
+	w.privateKeys[keyPair.PublicKey] = privateKey
+	return keyPair, nil
 }
 
-func (w *Wallet) Get(idx uint) *store.KeyPair {
+// GetKey returns a pre-derived key, or derives it on first use when it is outside the pre-derived range
+func (w *Wallet) GetKey(idx uint) (*store.KeyPair, error) {
+	w.mu.RLock()
 	keyPair := w.derivedKeys[idx]
-	if keyPair == nil {
-		path := fmt.Sprintf("m/1789'/0'/%d'", idx)
-		key, err := slip10.DeriveForPath(path, w.seed)
-		if err != nil {
-			log.Printf("cannot derive key: %v", err)
-			return nil
-		}
-		publicKey, privateKey := key.Keypair()
-		privateKeyHex := fmt.Sprintf("%x", privateKey)
-		publicKeyHex := fmt.Sprintf("%x", publicKey)
-		w.derivedKeys[idx] = store.NewKeyPair(privateKeyHex, publicKeyHex)
+	w.mu.RUnlock()
+	if keyPair != nil {
+		return keyPair, nil
 	}
-	return w.derivedKeys[idx]
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.derive(idx)
+}
+
+// Keys returns the keys derived so far, which may include indexes beyond the pre-derived range
+func (w *Wallet) Keys() (map[uint]*store.KeyPair, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return maps.Clone(w.derivedKeys), nil
+}
+
+func (w *Wallet) Sign(publicKey string, data []byte) ([]byte, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.seed == nil {
+		return nil, ErrSignerClosed
+	}
+	privateKey := w.privateKeys[strings.ToLower(publicKey)]
+	if privateKey == nil {
+		return nil, fmt.Errorf("cannot find key pair for pub key %s", publicKey)
+	}
+	return signEd25519(privateKey, data), nil
+}
+
+// Close zeroes the seed and every derived private key. The wallet cannot sign afterwards.
+func (w *Wallet) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	Zero(w.seed)
+	w.seed = nil
+	for publicKey, privateKey := range w.privateKeys {
+		Zero(privateKey)
+		delete(w.privateKeys, publicKey)
+	}
+}
+
+// signEd25519 signs the SHA3-256 hash of the data, as Vega expects for transaction signatures
+func signEd25519(privateKey ed25519.PrivateKey, data []byte) []byte {
+	hash := sha3.Sum256(data)
+	return ed25519.Sign(privateKey, hash[:])
 }
 
+// GetByPublicKey finds a key among those derived so far, which always includes the pre-derived range
 func (w *Wallet) GetByPublicKey(publicKey string) (*store.KeyPair, error) {
 	publicKey = strings.ToLower(publicKey)
-	for _, k := range maps.Values(w.derivedKeys) {
-		if k.PublicKey == publicKey {
-			return k, nil
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, keyPair := range w.derivedKeys {
+		if keyPair.PublicKey == publicKey {
+			return keyPair, nil
 		}
 	}
-	return nil, errors.New(fmt.Sprintf("cannot find key pair for pub key %s", publicKey))
+	return nil, fmt.Errorf("cannot find key pair for pub key %s", publicKey)
 }
@@ -1,69 +1,257 @@
 package bot
 
 import (
+	"code.vegaprotocol.io/vega/libs/ptr"
 	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
 	vegapb "code.vegaprotocol.io/vega/protos/vega"
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
+	"github.com/sasha-s/go-deadlock"
+	"github.com/shopspring/decimal"
+	"golang.org/x/exp/slices"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"vega-cli-mm/auth"
+	"vega-cli-mm/config"
+	"vega-cli-mm/journal"
 	"vega-cli-mm/logging"
+	"vega-cli-mm/snapshot"
 	"vega-cli-mm/store"
+	"vega-cli-mm/txmanager"
 	"vega-cli-mm/vega"
+	"vega-cli-mm/watchdog"
 )
 
+const EpochHistory = 30
+
+// KeyPauseAfterFailure is how long a key's markets stop quoting after it ran out of margin, or was banned for spam
+// without Vega saying when the ban ends. If the key is still unusable its next transaction fails and pauses it again.
+const KeyPauseAfterFailure = time.Minute
+
 type Bot struct {
-	store *store.Store
-	vega  *vega.Vega
+	store       *store.Store
+	vega        *vega.Vega
+	watchdog    *watchdog.Watchdog
+	journal     *journal.Journal
+	snapshotter *snapshot.Snapshotter
+	signer      auth.Signer
+	config      *config.Config
+	configPath  string
+	streamsLock deadlock.Mutex
 }
 
 func NewBot(
 	store *store.Store,
 	vega *vega.Vega,
+	watchdog *watchdog.Watchdog,
+	journal *journal.Journal,
+	snapshotter *snapshot.Snapshotter,
+	signer auth.Signer,
+	config *config.Config,
+	configPath string,
 ) *Bot {
 	return &Bot{
-		store: store,
-		vega:  vega,
+		store:       store,
+		vega:        vega,
+		watchdog:    watchdog,
+		journal:     journal,
+		snapshotter: snapshotter,
+		signer:      signer,
+		config:      config,
+		configPath:  configPath,
 	}
 }
 
-func (b *Bot) initWallet() {
-	secretFile, err := os.Open(".secret")
-	if err != nil {
-		logging.Panic(fmt.Sprintf("error loading .secret: %v", err))
+func (b *Bot) initAuthenticator() {
+	authenticator := auth.NewAuthenticator(b.vega.GetCoreNode(), b.signer, b.store, b.journal)
+	b.vega.SetAuthenticator(authenticator)
+}
+
+// watchTxFailures reports transactions that Vega rejected for good, or that kept failing after every retry, and
+// pauses the markets of a key that is banned for spam until the ban ends
+func (b *Bot) watchTxFailures() {
+	go func() {
+		for txErr := range b.vega.GetTxManager().Failures() {
+			logging.GetLogger().Errorf("%v", txErr)
+			record := txErr.Record
+			if txmanager.FailureKind(record.Failure) == txmanager.SpamBan {
+				until := time.Now().Add(KeyPauseAfterFailure)
+				ctx, cancel := context.WithTimeout(context.Background(), auth.PowWaitTimeout)
+				if bannedUntil, ok := b.vega.GetAuthenticator().GetBannedUntil(ctx, record.PartyId); ok {
+					until = bannedUntil
+				}
+				cancel()
+				b.pauseKey(record.PartyId, txmanager.SpamBan, until)
+			}
+		}
+	}()
+}
+
+// pauseKey stops the key's markets quoting until the given time
+func (b *Bot) pauseKey(partyId string, reason txmanager.FailureKind, until time.Time) {
+	if !until.After(time.Now()) {
+		return
 	}
-	mnemonicBytes, err := io.ReadAll(secretFile)
-	if err != nil {
-		logging.Panic(fmt.Sprintf("error loading .secret: %v", err))
+	if b.store.GetKeyPause(partyId) == nil {
+		logging.GetLogger().Errorf("%s cannot trade until %s: %s", partyId, until.UTC().Format(time.RFC3339), reason)
 	}
-	wallet := auth.NewWallet(string(mnemonicBytes))
-	authenticator := auth.NewAuthenticator(b.vega.GetCoreNode(), wallet, b.store)
-	b.vega.SetAuthenticator(authenticator)
+	b.store.PauseKey(&store.KeyPause{PartyId: partyId, Reason: string(reason), Until: until.UnixNano()})
 }
 
 func (b *Bot) loadMarkets() {
-	marketsFile, err := os.Open("markets.json")
-	if err != nil {
-		logging.Panic(fmt.Sprintf("error loading markets.json: %v", err))
+	report := b.config.Validate(nil)
+	if !report.IsValid() {
+		logging.Panic(report.String())
 	}
-	var markets []*store.MarketConfig
-	marketsJson, err := io.ReadAll(marketsFile)
-	if err != nil {
-		logging.Panic(fmt.Sprintf("error loading markets.json: %v", err))
+	for _, market := range b.config.Markets {
+		keyPair, err := b.signer.GetKey(*market.KeyIndex)
+		if err != nil {
+			logging.Panic(err.Error())
+		}
+		market.KeyPair = keyPair
+		b.store.SaveMarketConfig(market)
 	}
-	err = json.Unmarshal(marketsJson, &markets)
+}
+
+// checkKeyPositions warns when a market's key holds an open position in another market, which usually means the
+// key index was changed and the position has been orphaned
+func (b *Bot) checkKeyPositions() {
+	for _, marketConfig := range b.store.GetMarketConfig() {
+		for _, position := range b.store.GetPartyPositions(marketConfig.KeyPair.PublicKey) {
+			if position.MarketId != marketConfig.VegaId && position.OpenVolume != 0 {
+				logging.GetLogger().Warnf("key %d for market %s holds an open position of %d in market %s",
+					*marketConfig.KeyIndex, marketConfig.VegaId, position.OpenVolume, position.MarketId)
+			}
+		}
+	}
+}
+
+func (b *Bot) watchMarkets() {
+	go func() {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		lastModified := getModifiedTime(b.configPath)
+		ticker := time.NewTicker(time.Second * 5)
+		for {
+			select {
+			case <-hangup:
+				logging.GetLogger().Infof("reloading %s on SIGHUP", b.configPath)
+				lastModified = getModifiedTime(b.configPath)
+				b.reloadMarkets()
+			case <-ticker.C:
+				modified := getModifiedTime(b.configPath)
+				if modified.After(lastModified) {
+					logging.GetLogger().Infof("reloading %s after it changed", b.configPath)
+					lastModified = modified
+					b.reloadMarkets()
+				}
+			}
+		}
+	}()
+}
+
+func getModifiedTime(path string) time.Time {
+	info, err := os.Stat(path)
 	if err != nil {
-		logging.Panic(fmt.Sprintf("error loading markets.json: %v", err))
+		return time.Time{}
 	}
-	err = marketsFile.Close()
+	return info.ModTime()
+}
+
+// reloadMarkets applies changes to the markets section of the config file without a restart. Markets that are
+// still configured keep their reference prices, and removed markets have their orders and liquidity commitment
+// cancelled. A market whose key index changed is treated as removed and added again. An invalid file is ignored so
+// that the running config stays in place. Changes to any other section need a restart.
+func (b *Bot) reloadMarkets() {
+	reloaded, err := config.Load(b.configPath)
 	if err != nil {
-		logging.Panic(fmt.Sprintf("error closing markets.json: %v", err))
+		logging.GetLogger().Warnf("could not reload markets: %v", err)
+		return
 	}
-	for i, market := range markets {
-		market.KeyPair = b.vega.GetAuthenticator().GetWallet().Get(uint(i))
-		b.store.SaveMarketConfig(market)
+	report := reloaded.Validate(nil)
+	if !report.IsValid() {
+		logging.GetLogger().Warnf("could not reload markets: %s", report.String())
+		return
+	}
+	markets := reloaded.Markets
+	for _, market := range markets {
+		market.KeyPair, err = b.signer.GetKey(*market.KeyIndex)
+		if err != nil {
+			logging.GetLogger().Warnf("could not reload markets: %v", err)
+			return
+		}
+	}
+	b.streamsLock.Lock()
+	defer b.streamsLock.Unlock()
+	current := map[string]*store.MarketConfig{}
+	for _, market := range b.store.GetMarketConfig() {
+		current[market.VegaId] = market
+	}
+	removedMarkets := make([]*store.MarketConfig, 0)
+	streamsChanged := false
+	for _, market := range markets {
+		existing := current[market.VegaId]
+		delete(current, market.VegaId)
+		if existing != nil && *existing.KeyIndex != *market.KeyIndex {
+			logging.GetLogger().Warnf("market %s moved from key %d to key %d",
+				market.VegaId, *existing.KeyIndex, *market.KeyIndex)
+			removedMarkets = append(removedMarkets, existing)
+			existing = nil
+		}
+		if existing == nil {
+			streamsChanged = true
+			logging.GetLogger().Infof("added market %s on key %d", market.VegaId, *market.KeyIndex)
+			b.store.SaveMarketConfig(market)
+		} else {
+			b.store.UpdateMarketConfig(market)
+			if market.ExternalId != existing.ExternalId || market.PriceSource != existing.PriceSource ||
+				market.Spread != existing.Spread || market.ExposureLimit != existing.ExposureLimit ||
+				market.LpRatio != existing.LpRatio {
+				logging.GetLogger().Infof(
+					"updated market %s: externalId = %s; priceSource = %s; spread = %v; exposureLimit = %v; lpRatio = %v",
+					market.VegaId, market.ExternalId, market.PriceSource, market.Spread, market.ExposureLimit,
+					market.LpRatio)
+			}
+		}
+	}
+	for _, removed := range current {
+		b.store.RemoveMarketConfig(removed.VegaId)
+		removedMarkets = append(removedMarkets, removed)
+	}
+	for _, removed := range removedMarkets {
+		logging.GetLogger().Infof("removed market %s from key %d, cancelling orders and liquidity commitment",
+			removed.VegaId, *removed.KeyIndex)
+		streamsChanged = true
+		go func(partyId string, marketId string) {
+			err := b.vega.CancelOrders(context.Background(), partyId, marketId)
+			if err != nil {
+				logging.GetLogger().Warnf("%v", err)
+			}
+			err = b.vega.CancelLiquidityProvision(context.Background(), partyId, marketId)
+			if err != nil {
+				logging.GetLogger().Warnf("%v", err)
+			}
+		}(removed.KeyPair.PublicKey, removed.VegaId)
+	}
+	if streamsChanged {
+		b.vega.RestartMarketDataStream()
+		b.vega.RestartOrdersStream()
+		b.vega.RestartTradesStream()
+	}
+}
+
+// validateLiveMarkets checks the loaded market config against the markets on Vega once they have been synced
+func (b *Bot) validateLiveMarkets() {
+	liveMarkets := make([]*vegapb.Market, 0)
+	for _, marketConfig := range b.store.GetMarketConfig() {
+		if market := b.store.GetMarket(marketConfig.VegaId); market != nil {
+			liveMarkets = append(liveMarkets, market)
+		}
+	}
+	report := b.config.ValidateMarkets(b.store.GetMarketConfig(), liveMarkets)
+	if !report.IsValid() {
+		logging.GetLogger().Warn(report.String())
 	}
 }
 
@@ -77,7 +265,14 @@ func (b *Bot) updateReferencePrices() {
 				* 2) Use the relevant code to grab the price (for Binance it comes via WS, the ETH stuff will be sync)
 				* 3) Update config and save it in the store
 				 */
-				b.store.SaveMarketConfig(config)
+				b.store.SaveReferencePrice(config.VegaId, config.BidPrice, config.AskPrice)
+				if !config.BidPrice.IsZero() || !config.AskPrice.IsZero() {
+					b.journal.Record(journal.ReferencePrice, &journal.ReferencePriceSample{
+						MarketId: config.VegaId,
+						BidPrice: config.BidPrice,
+						AskPrice: config.AskPrice,
+					})
+				}
 			}
 		}
 	}()
@@ -86,104 +281,487 @@ func (b *Bot) updateReferencePrices() {
 func (b *Bot) connectToVegaStreams() {
 	go func() {
 		for range time.NewTicker(time.Second).C {
-			var marketIds []string
-			var partyIds []string
-			for _, config := range b.store.GetMarketConfig() {
-				partyId := config.KeyPair.PublicKey
-				marketIds = append(marketIds, config.VegaId)
-				partyIds = append(partyIds, partyId)
+			b.connectStreams()
+		}
+	}()
+}
+
+// connectStreams starts any stream that is down. It holds streamsLock so that a config reload cannot change the
+// markets between reading them here and starting the streams, which would leave a stream on the old markets.
+func (b *Bot) connectStreams() {
+	b.streamsLock.Lock()
+	defer b.streamsLock.Unlock()
+	var marketIds []string
+	var partyIds []string
+	for _, config := range b.store.GetMarketConfig() {
+		partyId := config.KeyPair.PublicKey
+		marketIds = append(marketIds, config.VegaId)
+		partyIds = append(partyIds, partyId)
+	}
+	if !b.vega.IsMarketDataConnected() {
+		b.vega.StreamMarketData(marketIds, func(marketData []*vegapb.MarketData) {
+			for _, data := range marketData {
+				b.store.SaveMarketData(data)
+				b.watchdog.MarketDataReceived(data.Market)
 			}
-			if !b.vega.IsMarketDataConnected() {
-				b.vega.StreamMarketData(marketIds, func(marketData []*vegapb.MarketData) {
-					for _, data := range marketData {
-						b.store.SaveMarketData(data)
-					}
-				})
+		})
+	}
+	if !b.vega.IsOrdersConnected() {
+		b.vega.StreamOrders(partyIds, func(orders []*vegapb.Order) {
+			for _, order := range orders {
+				b.saveOrder(order)
+				b.watchdog.OrderUpdateReceived(order.MarketId)
 			}
-			if !b.vega.IsOrdersConnected() {
-				b.vega.StreamOrders(partyIds, func(orders []*vegapb.Order) {
-					for _, order := range orders {
-						b.store.SaveOrder(order)
+		})
+	}
+	if !b.vega.IsTradesConnected() {
+		b.vega.StreamTrades(partyIds, func(trades []*vegapb.Trade) {
+			b.saveFills(trades, partyIds)
+		})
+	}
+	for _, partyId := range partyIds {
+		if !b.vega.IsAccountsConnected(partyId) {
+			b.vega.StreamAccounts(partyId, func(accounts []*apipb.AccountBalance) {
+				for _, account := range accounts {
+					b.store.SaveAccount(account)
+				}
+			})
+		}
+		if !b.vega.IsLiquidityProvisionsConnected(partyId) {
+			b.vega.StreamLiquidityProvisions(partyId, func(liquidityProvisions []*vegapb.LiquidityProvision) {
+				for _, lp := range liquidityProvisions {
+					b.store.SaveLiquidityProvision(lp)
+				}
+			})
+		}
+		if !b.vega.IsPositionsConnected(partyId) {
+			b.vega.StreamPositions(partyId, func(positions []*vegapb.Position) {
+				for _, position := range positions {
+					b.store.SavePosition(position)
+				}
+			})
+		}
+	}
+}
+
+func (b *Bot) monitorStreams() {
+	go func() {
+		for range time.NewTicker(time.Second).C {
+			for _, config := range b.store.GetMarketConfig() {
+				partyId := config.KeyPair.PublicKey
+				marketDataStale := b.watchdog.IsMarketDataStale(config.VegaId)
+				ordersStale := len(b.store.GetLiveOrders(config.VegaId, partyId)) > 0 &&
+					b.watchdog.IsOrdersStale(config.VegaId)
+				if ordersStale && b.ordersInSync(config.VegaId, partyId) {
+					b.watchdog.OrderUpdateReceived(config.VegaId)
+					ordersStale = false
+				}
+				wasHealthy := b.store.IsMarketHealthy(config.VegaId)
+				if !marketDataStale && !ordersStale {
+					if !wasHealthy {
+						logging.GetLogger().Infof("market is healthy: %s", config.VegaId)
 					}
-				})
-			}
-			for _, partyId := range partyIds {
-				if !b.vega.IsAccountsConnected(partyId) {
-					b.vega.StreamAccounts(partyId, func(accounts []*apipb.AccountBalance) {
-						for _, account := range accounts {
-							b.store.SaveAccount(account)
-						}
-					})
+					b.store.SaveMarketHealth(config.VegaId, true)
+					continue
 				}
-				if !b.vega.IsLiquidityProvisionsConnected(partyId) {
-					b.vega.StreamLiquidityProvisions(partyId, func(liquidityProvisions []*vegapb.LiquidityProvision) {
-						for _, lp := range liquidityProvisions {
-							b.store.SaveLiquidityProvision(lp)
+				b.store.SaveMarketHealth(config.VegaId, false)
+				if wasHealthy {
+					logging.GetLogger().Warnf("market is unhealthy: %s; stale market data = %v; stale orders = %v",
+						config.VegaId, marketDataStale, ordersStale)
+					go func(partyId string, marketId string) {
+						err := b.vega.CancelOrders(context.Background(), partyId, marketId)
+						if err != nil {
+							logging.GetLogger().Warnf("%v", err)
 						}
-					})
+					}(partyId, config.VegaId)
 				}
-				if !b.vega.IsPositionsConnected(partyId) {
-					b.vega.StreamPositions(partyId, func(positions []*vegapb.Position) {
-						for _, position := range positions {
-							b.store.SavePosition(position)
-						}
-					})
+				if b.watchdog.CanRestartStreams(config.VegaId) {
+					if marketDataStale {
+						b.vega.RestartMarketDataStream()
+					}
+					if ordersStale {
+						b.vega.RestartOrdersStream()
+					}
+					b.watchdog.StreamsRestarted(config.VegaId)
 				}
 			}
 		}
 	}()
 }
 
-func (b *Bot) syncVegaData() {
+// ordersInSync checks the live orders held for a market against the data node. Resting orders in a quiet market
+// get no updates, so the orders stream is only treated as stale once the store has actually drifted from Vega.
+func (b *Bot) ordersInSync(marketId string, partyId string) bool {
+	stored := map[string]*vegapb.Order{}
+	for _, order := range b.store.GetLiveOrders(marketId, partyId) {
+		stored[order.Id] = order
+	}
+	orders, err := b.vega.GetOrders([]string{partyId})
+	if err != nil {
+		// without a fresh list there is nothing to compare against, so leave the stream alone
+		logging.GetLogger().Warnf("%v", err)
+		return true
+	}
+	for _, order := range orders {
+		if order.MarketId != marketId {
+			continue
+		}
+		existing := stored[order.Id]
+		if existing == nil || existing.Version != order.Version || existing.Remaining != order.Remaining {
+			return false
+		}
+		delete(stored, order.Id)
+	}
+	return len(stored) == 0
+}
+
+// updateReadiness re-evaluates the startup gates of every market each second and logs any market whose
+// readiness changed
+func (b *Bot) updateReadiness() {
 	go func() {
-		for range time.NewTicker(time.Second * 15).C {
-			var marketIds []string
-			var partyIds []string
-			assets := b.vega.GetAssets()
-			for _, asset := range assets {
-				b.store.SaveAsset(asset)
-			}
-			markets := b.vega.GetMarkets()
-			for _, market := range markets {
-				b.store.SaveMarket(market)
-			}
-			marketData := b.vega.GetMarketData()
-			for _, data := range marketData {
-				b.store.SaveMarketData(data)
-			}
-			networkParameters := b.vega.GetNetworkParameters()
-			for _, param := range networkParameters {
-				b.store.SaveNetworkParameter(param)
-			}
+		for range time.NewTicker(time.Second).C {
 			for _, config := range b.store.GetMarketConfig() {
-				partyId := config.KeyPair.PublicKey
-				marketIds = append(marketIds, config.VegaId)
-				partyIds = append(partyIds, partyId)
-				liquidityProvisions := b.vega.GetLiquidityProvisions(partyId)
-				for _, lp := range liquidityProvisions {
-					b.store.SaveLiquidityProvision(lp)
+				readiness := b.getMarketReadiness(config)
+				wasReady := b.store.IsMarketReady(config.VegaId)
+				b.store.SaveMarketReadiness(readiness)
+				if readiness.IsReady() != wasReady {
+					logging.GetLogger().Infof("market %s readiness changed: ready = %v; %+v",
+						config.VegaId, readiness.IsReady(), *readiness)
 				}
 			}
-			orders := b.vega.GetOrders(partyIds)
-			for _, order := range orders {
-				b.store.SaveOrder(order)
+		}
+	}()
+}
+
+func (b *Bot) getMarketReadiness(config *store.MarketConfig) *store.MarketReadiness {
+	readiness := &store.MarketReadiness{
+		MarketId:     config.VegaId,
+		ConfigLoaded: config.KeyPair != nil,
+		StoreSynced:  b.store.IsReady(),
+		PowAvailable: b.vega.GetAuthenticator().HasProofOfWork(),
+	}
+	market := b.store.GetMarket(config.VegaId)
+	if market != nil {
+		readiness.MarketActive = market.State == vegapb.Market_STATE_ACTIVE ||
+			market.State == vegapb.Market_STATE_PENDING
+	}
+	if market != nil && config.KeyPair != nil {
+		assetId := market.GetTradableInstrument().GetInstrument().GetFuture().GetSettlementAsset()
+		for _, account := range b.store.GetAccounts("", vegapb.AccountType_ACCOUNT_TYPE_GENERAL) {
+			if account.Owner == config.KeyPair.PublicKey && account.Asset == assetId {
+				readiness.BalancesKnown = true
 			}
-			positions := b.vega.GetPositions(partyIds)
-			for _, position := range positions {
-				b.store.SavePosition(position)
+		}
+	}
+	if config.KeyPair != nil {
+		partyId := config.KeyPair.PublicKey
+		connections := b.vega.GetConnectionState()
+		readiness.StreamsUp = connections.MarketData && connections.Orders && connections.Trades &&
+			connections.Accounts[partyId] && connections.Positions[partyId] &&
+			connections.LiquidityProvisions[partyId] && b.store.IsMarketHealthy(config.VegaId)
+		readiness.KeyUsable = b.store.GetKeyPause(partyId) == nil
+	}
+	return readiness
+}
+
+// saveFills stores our side of each trade. Fills are stamped with the mid price at the time of the trade so that
+// spread capture can be measured, whether they arrive live or are backfilled. A stored fill whose mid price could
+// not be found is saved again once the market data stream history covers it, without asking the data node again.
+func (b *Bot) saveFills(trades []*vegapb.Trade, partyIds []string) {
+	for _, trade := range trades {
+		midPrice, priced := decimal.Zero, false
+		for _, partyId := range partyIds {
+			for _, fill := range store.NewFills(trade, partyId, decimal.Zero) {
+				if existing := b.store.GetFill(fill.TradeId, fill.PartyId, fill.Side); existing != nil {
+					midPrice, ok := b.store.GetMidPrice(trade.MarketId, trade.Timestamp)
+					if !existing.MidPrice.IsZero() || !ok {
+						continue
+					}
+					fill.MidPrice = midPrice
+				} else {
+					if !priced {
+						midPrice, priced = b.getMidPrice(trade.MarketId, trade.Timestamp), true
+					}
+					fill.MidPrice = midPrice
+				}
+				b.store.SaveFill(fill)
+				b.journal.Record(journal.Fill, fill)
 			}
-			accounts := b.vega.GetAccounts(partyIds)
-			for _, account := range accounts {
-				b.store.SaveAccount(account)
+		}
+	}
+}
+
+// getMidPrice returns the mid price at the timestamp from the stream history, falling back to the data node
+// for older trades. Zero is returned if neither knows it, which leaves the fill out of spread capture.
+func (b *Bot) getMidPrice(marketId string, timestamp int64) decimal.Decimal {
+	if midPrice, ok := b.store.GetMidPrice(marketId, timestamp); ok {
+		return midPrice
+	}
+	midPrice, err := b.vega.GetMidPrice(marketId, timestamp)
+	if err != nil {
+		logging.GetLogger().Warnf("could not get mid price for market %s at %d: %v", marketId, timestamp, err)
+		return decimal.Zero
+	}
+	return midPrice
+}
+
+// saveOrder stores the order and journals it when its state has changed since we last saw it. Vega only checks
+// margin once an order is executed, so an order rejected for lack of collateral pauses the key's markets.
+func (b *Bot) saveOrder(order *vegapb.Order) {
+	existing := b.store.GetOrder(order.Id)
+	if existing != nil && existing.Version == order.Version && existing.Status == order.Status &&
+		existing.Remaining == order.Remaining && existing.UpdatedAt == order.UpdatedAt {
+		return
+	}
+	b.store.SaveOrder(order)
+	b.journal.Record(journal.Order, order)
+	if order.Status != vegapb.Order_STATUS_REJECTED {
+		return
+	}
+	logging.GetLogger().Warnf("order %s for market %s from %s was rejected: %s", order.Id, order.MarketId,
+		order.PartyId, order.GetReason())
+	switch order.GetReason() {
+	case vegapb.OrderError_ORDER_ERROR_MARGIN_CHECK_FAILED, vegapb.OrderError_ORDER_ERROR_INSUFFICIENT_ASSET_BALANCE:
+		// an order rejected long ago, for example one backfilled after a restart, leaves an expired pause
+		rejectedAt := time.Unix(0, order.CreatedAt)
+		if order.UpdatedAt > order.CreatedAt {
+			rejectedAt = time.Unix(0, order.UpdatedAt)
+		}
+		b.pauseKey(order.PartyId, txmanager.InsufficientMargin, rejectedAt.Add(KeyPauseAfterFailure))
+	}
+}
+
+// syncEpochs fetches the current epoch and any of the previous EpochHistory epochs that are not stored yet,
+// together with the rewards paid to our keys over those epochs. It returns false if any fetch failed.
+func (b *Bot) syncEpochs(partyIds []string) bool {
+	epoch, err := b.vega.GetEpoch(nil)
+	if err != nil {
+		logging.GetLogger().Warnf("%v", err)
+		return false
+	}
+	b.store.SaveEpoch(epoch)
+	missing := make([]*uint64, 0)
+	for i := uint64(1); i <= EpochHistory && i <= epoch.Seq; i++ {
+		if seq := epoch.Seq - i; b.store.GetEpoch(seq) == nil {
+			missing = append(missing, ptr.From(seq))
+		}
+	}
+	pastEpochs, err := b.vega.GetEpochs(missing)
+	if err != nil {
+		logging.GetLogger().Warnf("%v", err)
+		return false
+	}
+	for _, pastEpoch := range pastEpochs {
+		b.store.SaveEpoch(pastEpoch)
+	}
+	fromEpoch := uint64(0)
+	if epoch.Seq > EpochHistory {
+		fromEpoch = epoch.Seq - EpochHistory
+	}
+	rewards, err := b.vega.GetRewards(partyIds, fromEpoch)
+	if err != nil {
+		logging.GetLogger().Warnf("%v", err)
+		return false
+	}
+	for _, reward := range rewards {
+		b.store.SaveReward(reward)
+	}
+	return true
+}
+
+// syncFunding fetches the deposits, withdrawals and transfers of our keys. It returns false if any fetch failed.
+func (b *Bot) syncFunding(partyIds []string) bool {
+	ok := true
+	for _, partyId := range partyIds {
+		deposits, err := b.vega.GetDeposits(partyId)
+		if err != nil {
+			logging.GetLogger().Warnf("%v", err)
+			ok = false
+		}
+		for _, deposit := range deposits {
+			b.store.SaveDeposit(deposit)
+		}
+		withdrawals, err := b.vega.GetWithdrawals(partyId)
+		if err != nil {
+			logging.GetLogger().Warnf("%v", err)
+			ok = false
+		}
+		for _, withdrawal := range withdrawals {
+			b.store.SaveWithdrawal(withdrawal)
+		}
+		transfers, err := b.vega.GetTransfers(partyId)
+		if err != nil {
+			logging.GetLogger().Warnf("%v", err)
+			ok = false
+		}
+		for _, transfer := range transfers {
+			b.store.SaveTransfer(transfer)
+		}
+	}
+	return ok
+}
+
+// syncVegaData refreshes the store every 15 seconds. Until a full sync has succeeded the store is not ready, so
+// each attempt reconciles and marks it ready once every fetch succeeds.
+func (b *Bot) syncVegaData() {
+	go func() {
+		for range time.NewTicker(time.Second * 15).C {
+			if b.store.IsReady() {
+				b.sync(false)
+			} else {
+				b.resync()
 			}
 		}
 	}()
 }
 
+// resync performs a full sync and reconciliation, marking the store ready only if every fetch succeeded
+func (b *Bot) resync() {
+	if !b.sync(true) {
+		logging.GetLogger().Warn("store is not ready, the sync with the data node failed and will be retried")
+		return
+	}
+	b.validateLiveMarkets()
+	b.checkKeyPositions()
+	b.store.SetReady(true)
+	logging.GetLogger().Info("store is ready")
+}
+
+// sync refreshes the store from the data node and returns false if any fetch failed. When reconciling, our
+// orders, positions and accounts that are held in the store but no longer reported by Vega are removed, which is
+// needed after a warm start. A collection is only reconciled against a fetch that succeeded, since a failed fetch
+// says nothing about what Vega still holds.
+func (b *Bot) sync(reconcile bool) bool {
+	ok := true
+	failed := func(err error) bool {
+		if err != nil {
+			logging.GetLogger().Warnf("%v", err)
+			ok = false
+		}
+		return err != nil
+	}
+	var partyIds []string
+	assets, err := b.vega.GetAssets()
+	failed(err)
+	for _, asset := range assets {
+		b.store.SaveAsset(asset)
+	}
+	markets, err := b.vega.GetMarkets()
+	failed(err)
+	for _, market := range markets {
+		b.store.SaveMarket(market)
+	}
+	marketData, err := b.vega.GetMarketData()
+	failed(err)
+	for _, data := range marketData {
+		b.store.SaveMarketData(data)
+	}
+	networkParameters, err := b.vega.GetNetworkParameters()
+	failed(err)
+	for _, param := range networkParameters {
+		b.store.SaveNetworkParameter(param)
+	}
+	for _, config := range b.store.GetMarketConfig() {
+		partyId := config.KeyPair.PublicKey
+		partyIds = append(partyIds, partyId)
+		liquidityProvisions, err := b.vega.GetLiquidityProvisions(partyId)
+		failed(err)
+		for _, lp := range liquidityProvisions {
+			b.store.SaveLiquidityProvision(lp)
+		}
+	}
+	orders, err := b.vega.GetOrders(partyIds)
+	if !failed(err) {
+		for _, order := range orders {
+			b.saveOrder(order)
+		}
+		if reconcile {
+			b.logReconciled("orders", b.store.ReconcileOrders(partyIds, orders))
+		}
+	}
+	trades, err := b.vega.GetTrades(partyIds)
+	failed(err)
+	b.saveFills(trades, partyIds)
+	ledgerEntries, err := b.vega.GetLedgerEntries(partyIds, []vegapb.TransferType{
+		vegapb.TransferType_TRANSFER_TYPE_LIQUIDITY_FEE_DISTRIBUTE,
+		vegapb.TransferType_TRANSFER_TYPE_BOND_SLASHING,
+	})
+	failed(err)
+	for _, entry := range ledgerEntries {
+		b.store.SaveLedgerEntry(entry)
+	}
+	if !b.syncEpochs(partyIds) {
+		ok = false
+	}
+	if !b.syncFunding(partyIds) {
+		ok = false
+	}
+	positions, err := b.vega.GetPositions(partyIds)
+	if !failed(err) {
+		for _, position := range positions {
+			b.store.SavePosition(position)
+		}
+		if reconcile {
+			b.logReconciled("positions", b.store.ReconcilePositions(partyIds, positions))
+		}
+	}
+	// accounts are fetched for every key the signer holds, so that the inventory also covers idle keys
+	accountPartyIds := b.getAllPartyIds(partyIds)
+	accounts, err := b.vega.GetAccounts(accountPartyIds)
+	if !failed(err) {
+		for _, account := range accounts {
+			b.store.SaveAccount(account)
+		}
+		if reconcile {
+			b.logReconciled("accounts", b.store.ReconcileAccounts(accountPartyIds, accounts))
+		}
+	}
+	return ok
+}
+
+// getAllPartyIds adds every key the signer holds to the market keys. The market keys are returned alone if the
+// signer cannot list its keys.
+func (b *Bot) getAllPartyIds(marketPartyIds []string) []string {
+	keys, err := b.signer.Keys()
+	if err != nil {
+		logging.GetLogger().Warnf("could not list keys: %v", err)
+		return marketPartyIds
+	}
+	partyIds := append([]string{}, marketPartyIds...)
+	for _, keyPair := range keys {
+		if !slices.Contains(partyIds, keyPair.PublicKey) {
+			partyIds = append(partyIds, keyPair.PublicKey)
+		}
+	}
+	return partyIds
+}
+
+func (b *Bot) logReconciled(name string, removed []string) {
+	if len(removed) > 0 {
+		logging.GetLogger().Warnf("removed %d stale %s during reconciliation: %v", len(removed), name, removed)
+	}
+}
+
+// warmStart loads the last snapshot so that state is available immediately, then performs a full resync
+// and reconciliation. The store is only marked ready, allowing quoting to start, once that has succeeded.
+func (b *Bot) warmStart() {
+	loaded, err := b.snapshotter.Load()
+	if err != nil {
+		logging.GetLogger().Warnf("could not load store snapshot: %v", err)
+	} else if !loaded {
+		logging.GetLogger().Info("no store snapshot found, starting cold")
+	}
+	b.resync()
+	b.snapshotter.Start()
+}
+
 func (b *Bot) updateLiquidityCommitment() {
 	go func() {
 		for range time.NewTicker(time.Second).C {
 			for _, config := range b.store.GetMarketConfig() {
+				if !b.store.IsMarketReady(config.VegaId) {
+					continue
+				}
 				// TODO - connect liquidity commitment on Vega
 				/**
 				* 1) Get Vega balance to determine commitment size
@@ -200,6 +778,9 @@ func (b *Bot) updateQuotes() {
 	go func() {
 		for range time.NewTicker(time.Second).C {
 			for _, config := range b.store.GetMarketConfig() {
+				if !b.store.IsMarketReady(config.VegaId) {
+					continue
+				}
 				// TODO - update quotes on Vega
 				/**
 				* 1) Get reference price for market
@@ -214,10 +795,15 @@ func (b *Bot) updateQuotes() {
 }
 
 func (b *Bot) Start() {
-	b.initWallet()
+	b.initAuthenticator()
+	b.watchTxFailures()
 	b.loadMarkets()
+	b.warmStart()
 	b.syncVegaData()
 	b.connectToVegaStreams()
+	b.monitorStreams()
+	b.updateReadiness()
+	b.watchMarkets()
 	b.updateReferencePrices()
 	b.updateLiquidityCommitment()
 	b.updateQuotes()
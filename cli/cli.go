@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"vega-cli-mm/config"
+	"vega-cli-mm/logging"
+)
+
+const Name = "vega-cli-mm"
+
+type Options struct {
+	ConfigPath string
+	Config     *config.Config
+}
+
+type Command struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Run         func(options *Options, args []string) error
+	Subcommands []*Command
+}
+
+func (c *Command) matches(name string) bool {
+	if c.Name == name {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+var errUsage = errors.New("usage")
+
+// Run parses the global flags, loads the config file and dispatches to the requested command, returning the process
+// exit code. Flags that are set explicitly take precedence over both the config file and its environment overrides.
+func Run(args []string) int {
+	options := &Options{}
+	overrides := map[string]*string{}
+	flags := flag.NewFlagSet(Name, flag.ContinueOnError)
+	flags.StringVar(&options.ConfigPath, "config", getEnv("VEGA_MM_CONFIG", "config.yaml"),
+		"path to the config file [VEGA_MM_CONFIG]")
+	overrides["core-node"] = flags.String("core-node", "",
+		"address of the Vega node used for both core and data node APIs, overrides nodes.core")
+	overrides["secret"] = flags.String("secret", "",
+		"path to the encrypted keystore holding the wallet mnemonic, overrides secret.path")
+	overrides["api-address"] = flags.String("api-address", "",
+		"address the API listens on, overrides api.address")
+	overrides["log-level"] = flags.String("log-level", "",
+		"one of debug, info or quiet, overrides logging.level")
+	flags.Usage = func() {
+		printUsage(flags.Output(), flags)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	command, commandArgs := findCommand(commands, flags.Args())
+	if command == nil || command.Run == nil {
+		printUsage(os.Stderr, flags)
+		return 2
+	}
+	options.Config, err = config.Load(options.ConfigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if value, ok := overrides[f.Name]; ok {
+			applyOverride(options.Config, f.Name, *value)
+		}
+	})
+	err = logging.SetLevel(options.Config.Logging.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	err = command.Run(options, commandArgs)
+	if errors.Is(err, errUsage) {
+		printUsage(os.Stderr, flags)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func applyOverride(appConfig *config.Config, name string, value string) {
+	switch name {
+	case "core-node":
+		appConfig.Nodes.Core = value
+	case "secret":
+		appConfig.Secret.Path = value
+	case "api-address":
+		appConfig.Api.Address = value
+	case "log-level":
+		appConfig.Logging.Level = value
+	}
+}
+
+func findCommand(available []*Command, args []string) (*Command, []string) {
+	if len(args) == 0 {
+		return nil, args
+	}
+	for _, command := range available {
+		if !command.matches(args[0]) {
+			continue
+		}
+		if len(command.Subcommands) > 0 {
+			return findCommand(command.Subcommands, args[1:])
+		}
+		return command, args[1:]
+	}
+	return nil, args
+}
+
+func printUsage(out io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [args]\n\nCommands:\n", Name)
+	printCommands(out, commands, "")
+	fmt.Fprintln(out, "\nFlags:")
+	flags.SetOutput(out)
+	flags.PrintDefaults()
+}
+
+func printCommands(out io.Writer, available []*Command, prefix string) {
+	for _, command := range available {
+		name := strings.TrimSpace(prefix + " " + command.Name)
+		if len(command.Subcommands) > 0 {
+			printCommands(out, command.Subcommands, name)
+			continue
+		}
+		fmt.Fprintf(out, "  %-22s %s\n", name, command.Description)
+	}
+}
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,489 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tyler-smith/go-bip39"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"vega-cli-mm/api"
+	"vega-cli-mm/auth"
+	"vega-cli-mm/bot"
+	"vega-cli-mm/config"
+	"vega-cli-mm/funding"
+	"vega-cli-mm/income"
+	"vega-cli-mm/inventory"
+	"vega-cli-mm/journal"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/pnl"
+	"vega-cli-mm/snapshot"
+	"vega-cli-mm/store"
+	"vega-cli-mm/treasury"
+	"vega-cli-mm/vega"
+	"vega-cli-mm/watchdog"
+)
+
+var commands = []*Command{
+	{
+		Name:        "run",
+		Description: "run the market maker",
+		Run:         runBot,
+	},
+	{
+		Name:        "validate-config",
+		Aliases:     []string{"validate"},
+		Description: "check the config file and its markets against Vega",
+		Run:         validateConfig,
+	},
+	{
+		Name: "keys",
+		Subcommands: []*Command{
+			{
+				Name:        "init",
+				Description: "create an encrypted keystore holding a new mnemonic",
+				Run:         initKeys,
+			},
+			{
+				Name:        "import",
+				Description: "encrypt an existing mnemonic, read from [file] or the terminal, into a keystore",
+				Run:         importKeys,
+			},
+			{
+				Name:        "list",
+				Description: "list the derived keys and the markets they trade",
+				Run:         listKeys,
+			},
+			{
+				Name:        "inventory",
+				Description: "show every key with its market and general, margin and bond balances",
+				Run:         showInventory,
+			},
+		},
+	},
+	{
+		Name:        "balances",
+		Description: "show account balances for every market key",
+		Run:         showBalances,
+	},
+	{
+		Name: "orders",
+		Subcommands: []*Command{
+			{
+				Name:        "cancel-all",
+				Description: "cancel all orders in every configured market",
+				Run:         cancelAllOrders,
+			},
+		},
+	},
+	{
+		Name:        "positions",
+		Description: "show positions for every market key",
+		Run:         showPositions,
+	},
+}
+
+func keepAlive() {
+	gracefulStop := make(chan os.Signal, 1)
+	signal.Notify(gracefulStop, syscall.SIGTERM, syscall.SIGINT)
+	<-gracefulStop
+	logging.GetLogger().Info("shutting down on user request")
+}
+
+func runBot(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	appConfig := options.Config
+	report := appConfig.Validate(nil)
+	if !report.IsValid() {
+		return errors.New(report.String())
+	}
+	signer, err := openSigner(options)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	appStore := store.NewStore()
+	vegaClient := vega.NewVega(appStore, appConfig.Nodes.Core)
+	streamWatchdog := watchdog.NewWatchdog(
+		appConfig.Watchdog.MarketDataStaleAfter, appConfig.Watchdog.OrdersStaleAfter,
+	)
+	appJournal := journal.NewJournal(appConfig.Storage.JournalDir, appConfig.Storage.JournalMaxSize)
+	defer appJournal.Close()
+	snapshotter := snapshot.NewSnapshotter(
+		appStore, appConfig.Storage.SnapshotPath, appConfig.Storage.SnapshotInterval,
+	)
+	bot.NewBot(
+		appStore, vegaClient, streamWatchdog, appJournal, snapshotter, signer, appConfig, options.ConfigPath,
+	).Start()
+	if appConfig.Treasury.Enabled {
+		fundingKey, err := signer.GetKey(appConfig.Treasury.FundingKeyIndex)
+		if err != nil {
+			return err
+		}
+		treasury.NewTreasury(appStore, vegaClient, appConfig.Treasury, fundingKey).Start()
+	}
+	appPnl := pnl.NewPnl(appStore)
+	appPnl.Start()
+	appIncome := income.NewIncome(appStore)
+	appInventory := inventory.NewInventory(appStore, signer)
+	appFunding := funding.NewFunding(appStore)
+	api.NewApi(appStore, appPnl, appIncome, appInventory, appFunding, appConfig.Api.Address).Start()
+	keepAlive()
+	return nil
+}
+
+func validateConfig(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	report := options.Config.Validate(nil)
+	if report.IsValid() {
+		vegaClient := vega.NewVega(store.NewStore(), options.Config.Nodes.Core)
+		markets, err := vegaClient.GetMarkets()
+		if err != nil {
+			// the markets could not be checked, which says nothing about whether they are configured correctly
+			return fmt.Errorf("config is valid but the markets could not be checked against %s: %w",
+				options.Config.Nodes.Core, err)
+		}
+		report = options.Config.Validate(markets)
+	}
+	if !report.IsValid() {
+		return errors.New(report.String())
+	}
+	fmt.Println(report.String())
+	return nil
+}
+
+// loadMarketKeys validates the config and assigns each market its key from the signer
+func loadMarketKeys(options *Options) ([]*store.MarketConfig, auth.Signer, error) {
+	report := options.Config.Validate(nil)
+	if !report.IsValid() {
+		return nil, nil, errors.New(report.String())
+	}
+	markets := options.Config.Markets
+	signer, err := openSigner(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, market := range markets {
+		market.KeyPair, err = signer.GetKey(*market.KeyIndex)
+		if err != nil {
+			signer.Close()
+			return nil, nil, err
+		}
+	}
+	sort.Slice(markets, func(i, j int) bool {
+		return *markets[i].KeyIndex < *markets[j].KeyIndex
+	})
+	return markets, signer, nil
+}
+
+func getPassphraseSource(options *Options) auth.PassphraseSource {
+	return auth.PassphraseSource{Env: options.Config.Secret.PassphraseEnv, Fd: options.Config.Secret.PassphraseFd}
+}
+
+// openSigner opens the signer backend selected in the config
+func openSigner(options *Options) (auth.Signer, error) {
+	signerConfig := options.Config.Signer
+	switch signerConfig.Backend {
+	case config.MnemonicSigner:
+		wallet, err := newWallet(options, []byte(os.Getenv(signerConfig.MnemonicEnv)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot use mnemonic from %s: %v", signerConfig.MnemonicEnv, err)
+		}
+		return wallet, nil
+	case config.HexKeysSigner:
+		return auth.LoadKeySigner(signerConfig.HexKeysPath)
+	case config.RemoteSigner:
+		remote := signerConfig.Remote
+		return auth.NewRemoteSigner(remote.Url, remote.Wallet, remote.Token, remote.Timeout), nil
+	default:
+		return openWallet(options)
+	}
+}
+
+func openWallet(options *Options) (*auth.Wallet, error) {
+	passphrase, err := getPassphraseSource(options).Read(false)
+	if err != nil {
+		return nil, err
+	}
+	defer auth.Zero(passphrase)
+	return auth.LoadWallet(
+		options.Config.Secret.Path,
+		passphrase,
+		os.Getenv(options.Config.Signer.Bip39PassphraseEnv),
+		options.Config.Signer.DerivationPath,
+		options.Config.Signer.KeyCount,
+	)
+}
+
+func newWallet(options *Options, mnemonic []byte) (*auth.Wallet, error) {
+	return auth.NewWallet(
+		string(mnemonic),
+		os.Getenv(options.Config.Signer.Bip39PassphraseEnv),
+		options.Config.Signer.DerivationPath,
+		options.Config.Signer.KeyCount,
+	)
+}
+
+// saveMnemonic encrypts the mnemonic into the configured keystore, refusing to replace one that already exists.
+// The BIP39 passphrase is not stored, it must be supplied again whenever the keystore is opened.
+func saveMnemonic(options *Options, mnemonic []byte) error {
+	path := options.Config.Secret.Path
+	wallet, err := newWallet(options, mnemonic)
+	if err != nil {
+		return err
+	}
+	defer wallet.Close()
+	keyPair, err := wallet.GetKey(0)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists, move it out of the way first", path)
+	}
+	passphrase, err := getPassphraseSource(options).Read(true)
+	if err != nil {
+		return err
+	}
+	defer auth.Zero(passphrase)
+	keystore, err := auth.EncryptKeystore(mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+	err = auth.SaveKeystore(path, keystore)
+	if err != nil {
+		return fmt.Errorf("cannot save %s: %v", path, err)
+	}
+	fmt.Printf("saved keystore to %s, key 0 is %s\n", path, keyPair.PublicKey)
+	return nil
+}
+
+func initKeys(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return err
+	}
+	defer auth.Zero(entropy)
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return err
+	}
+	err = saveMnemonic(options, []byte(mnemonic))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nwrite down this mnemonic and keep it somewhere safe, it will not be shown again:\n\n%s\n", mnemonic)
+	return nil
+}
+
+// importKeys encrypts an existing mnemonic. A file is read byte for byte, so that a plaintext secret file from an
+// older version derives exactly the same keys once imported.
+func importKeys(options *Options, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	var mnemonic []byte
+	var err error
+	if len(args) == 1 {
+		mnemonic, err = os.ReadFile(args[0])
+	} else {
+		mnemonic, err = auth.ReadSecretLine("Mnemonic: ")
+		if err != nil {
+			return fmt.Errorf("no mnemonic given: %w", err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer auth.Zero(mnemonic)
+	err = saveMnemonic(options, mnemonic)
+	if err == nil && len(args) == 1 {
+		fmt.Printf("%s can now be deleted\n", args[0])
+	}
+	return err
+}
+
+func getPartyIds(markets []*store.MarketConfig) []string {
+	partyIds := make([]string, 0, len(markets))
+	for _, market := range markets {
+		partyIds = append(partyIds, market.KeyPair.PublicKey)
+	}
+	return partyIds
+}
+
+func listKeys(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	markets, signer, err := loadMarketKeys(options)
+	if err != nil {
+		return err
+	}
+	signer.Close()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tPUBLIC KEY\tMARKET")
+	for _, market := range markets {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", *market.KeyIndex, market.KeyPair.PublicKey, market.VegaId)
+	}
+	return w.Flush()
+}
+
+// showInventory loads the assets and the accounts of every key the signer holds, not just those assigned to a
+// market, into a store and prints the inventory built from it
+func showInventory(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	markets, signer, err := loadMarketKeys(options)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	keys, err := signer.Keys()
+	if err != nil {
+		return err
+	}
+	publicKeys := make([]string, 0, len(keys))
+	for _, keyPair := range keys {
+		publicKeys = append(publicKeys, keyPair.PublicKey)
+	}
+	appStore := store.NewStore()
+	for _, market := range markets {
+		appStore.SaveMarketConfig(market)
+	}
+	vegaClient := vega.NewVega(appStore, options.Config.Nodes.Core)
+	assets, err := vegaClient.GetAssets()
+	if err != nil {
+		return err
+	}
+	for _, asset := range assets {
+		appStore.SaveAsset(asset)
+	}
+	accounts, err := vegaClient.GetAccounts(publicKeys)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		appStore.SaveAccount(account)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tPUBLIC KEY\tMARKET\tASSET\tGENERAL\tMARGIN\tBOND")
+	for _, key := range inventory.NewInventory(appStore, signer).GetInventory() {
+		marketId := key.MarketId
+		if len(marketId) == 0 {
+			marketId = "-"
+		}
+		if len(key.Balances) == 0 {
+			fmt.Fprintf(w, "%d\t%s\t%s\t-\t-\t-\t-\n", key.KeyIndex, key.PublicKey, marketId)
+		}
+		for _, balance := range key.Balances {
+			asset := balance.Symbol
+			if len(asset) == 0 {
+				asset = balance.AssetId
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", key.KeyIndex, key.PublicKey, marketId, asset,
+				balance.General, balance.Margin, balance.Bond)
+		}
+	}
+	return w.Flush()
+}
+
+func showBalances(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	markets, signer, err := loadMarketKeys(options)
+	if err != nil {
+		return err
+	}
+	signer.Close()
+	vegaClient := vega.NewVega(store.NewStore(), options.Config.Nodes.Core)
+	accounts, err := vegaClient.GetAccounts(getPartyIds(markets))
+	if err != nil {
+		return err
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Owner == accounts[j].Owner {
+			return accounts[i].Type < accounts[j].Type
+		}
+		return accounts[i].Owner < accounts[j].Owner
+	})
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTY\tTYPE\tASSET\tMARKET\tBALANCE")
+	for _, account := range accounts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			account.Owner, account.Type, account.Asset, account.MarketId, account.Balance)
+	}
+	return w.Flush()
+}
+
+func showPositions(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	markets, signer, err := loadMarketKeys(options)
+	if err != nil {
+		return err
+	}
+	signer.Close()
+	vegaClient := vega.NewVega(store.NewStore(), options.Config.Nodes.Core)
+	positions, err := vegaClient.GetPositions(getPartyIds(markets))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTY\tMARKET\tOPEN VOLUME\tENTRY PRICE\tREALISED PNL\tUNREALISED PNL")
+	for _, position := range positions {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", position.PartyId, position.MarketId, position.OpenVolume,
+			position.AverageEntryPrice, position.RealisedPnl, position.UnrealisedPnl)
+	}
+	return w.Flush()
+}
+
+// cancelAllOrders signs a cancellation for every configured market. The authenticator needs the network
+// parameters in the store before it can compute proof of work, so they are loaded first.
+func cancelAllOrders(options *Options, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	markets, signer, err := loadMarketKeys(options)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	appStore := store.NewStore()
+	vegaClient := vega.NewVega(appStore, options.Config.Nodes.Core)
+	networkParameters, err := vegaClient.GetNetworkParameters()
+	if err != nil {
+		return err
+	}
+	for _, param := range networkParameters {
+		appStore.SaveNetworkParameter(param)
+	}
+	vegaClient.SetAuthenticator(auth.NewAuthenticator(options.Config.Nodes.Core, signer, appStore, nil))
+	// an interrupt stops any cancellation still waiting for PoW or the node, rather than leaving it running
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed := 0
+	for _, market := range markets {
+		fmt.Printf("cancelling orders for market %s on key %d\n", market.VegaId, *market.KeyIndex)
+		err = vegaClient.CancelOrders(ctx, market.KeyPair.PublicKey, market.VegaId)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not cancel orders in %d of %d markets", failed, len(markets))
+	}
+	return nil
+}
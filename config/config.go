@@ -0,0 +1,447 @@
+package config
+
+import (
+	"bytes"
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+	"vega-cli-mm/auth"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/store"
+)
+
+type NodesConfig struct {
+	Core string `yaml:"core"`
+}
+
+type ApiConfig struct {
+	Address string `yaml:"address"`
+}
+
+type LoggingConfig struct {
+	Level string `yaml:"level"`
+}
+
+type SecretConfig struct {
+	Path          string `yaml:"path"`
+	PassphraseEnv string `yaml:"passphraseEnv"`
+	PassphraseFd  int    `yaml:"passphraseFd"`
+}
+
+type RemoteSignerConfig struct {
+	Url     string        `yaml:"url"`
+	Wallet  string        `yaml:"wallet"`
+	Token   string        `yaml:"token"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type SignerBackend string
+
+const (
+	KeystoreSigner SignerBackend = "keystore"
+	MnemonicSigner SignerBackend = "mnemonic"
+	HexKeysSigner  SignerBackend = "hexKeys"
+	RemoteSigner   SignerBackend = "remote"
+)
+
+var signerBackends = []SignerBackend{KeystoreSigner, MnemonicSigner, HexKeysSigner, RemoteSigner}
+
+type SignerConfig struct {
+	Backend            SignerBackend      `yaml:"backend"`
+	MnemonicEnv        string             `yaml:"mnemonicEnv"`
+	Bip39PassphraseEnv string             `yaml:"bip39PassphraseEnv"`
+	DerivationPath     string             `yaml:"derivationPath"`
+	KeyCount           uint               `yaml:"keyCount"`
+	HexKeysPath        string             `yaml:"hexKeysPath"`
+	Remote             RemoteSignerConfig `yaml:"remote"`
+}
+
+type BinanceConfig struct {
+	Url       string `yaml:"url"`
+	ApiKey    string `yaml:"apiKey"`
+	ApiSecret string `yaml:"apiSecret"`
+}
+
+type PythConfig struct {
+	Url string `yaml:"url"`
+}
+
+type ChainlinkConfig struct {
+	EthereumRpcUrl string `yaml:"ethereumRpcUrl"`
+}
+
+type PriceSourcesConfig struct {
+	Binance   BinanceConfig   `yaml:"binance"`
+	Pyth      PythConfig      `yaml:"pyth"`
+	Chainlink ChainlinkConfig `yaml:"chainlink"`
+}
+
+type RiskConfig struct {
+	MaxSpread        float64 `yaml:"maxSpread"`
+	MaxExposureLimit float64 `yaml:"maxExposureLimit"`
+}
+
+type WatchdogConfig struct {
+	MarketDataStaleAfter time.Duration `yaml:"marketDataStaleAfter"`
+	OrdersStaleAfter     time.Duration `yaml:"ordersStaleAfter"`
+}
+
+type TreasuryAssetConfig struct {
+	AssetId       string  `yaml:"assetId"`
+	MinBalance    float64 `yaml:"minBalance"`
+	TargetBalance float64 `yaml:"targetBalance"`
+	MaxBalance    float64 `yaml:"maxBalance"`
+	DailyLimit    float64 `yaml:"dailyLimit"`
+}
+
+type TreasuryConfig struct {
+	Enabled         bool                   `yaml:"enabled"`
+	FundingKeyIndex uint                   `yaml:"fundingKeyIndex"`
+	Interval        time.Duration          `yaml:"interval"`
+	Assets          []*TreasuryAssetConfig `yaml:"assets"`
+}
+
+type StorageConfig struct {
+	JournalDir       string        `yaml:"journalDir"`
+	JournalMaxSize   int64         `yaml:"journalMaxSize"`
+	SnapshotPath     string        `yaml:"snapshotPath"`
+	SnapshotInterval time.Duration `yaml:"snapshotInterval"`
+}
+
+type Config struct {
+	Nodes        NodesConfig           `yaml:"nodes"`
+	Api          ApiConfig             `yaml:"api"`
+	Logging      LoggingConfig         `yaml:"logging"`
+	Secret       SecretConfig          `yaml:"secret"`
+	Signer       SignerConfig          `yaml:"signer"`
+	PriceSources PriceSourcesConfig    `yaml:"priceSources"`
+	Risk         RiskConfig            `yaml:"risk"`
+	Watchdog     WatchdogConfig        `yaml:"watchdog"`
+	Storage      StorageConfig         `yaml:"storage"`
+	Treasury     TreasuryConfig        `yaml:"treasury"`
+	Markets      []*store.MarketConfig `yaml:"markets"`
+}
+
+func NewDefaultConfig() *Config {
+	return &Config{
+		Nodes:   NodesConfig{Core: "darling.network:3007"},
+		Api:     ApiConfig{Address: ":8080"},
+		Logging: LoggingConfig{Level: string(logging.Info)},
+		Secret: SecretConfig{
+			Path:          "keystore.json",
+			PassphraseEnv: "VEGA_MM_PASSPHRASE",
+			PassphraseFd:  -1,
+		},
+		Signer: SignerConfig{
+			Backend:            KeystoreSigner,
+			MnemonicEnv:        "VEGA_MM_MNEMONIC",
+			Bip39PassphraseEnv: "VEGA_MM_BIP39_PASSPHRASE",
+			DerivationPath:     auth.DefaultDerivationPath,
+			KeyCount:           20,
+			HexKeysPath:        "keys.txt",
+			Remote:             RemoteSignerConfig{Timeout: time.Second * 10},
+		},
+		PriceSources: PriceSourcesConfig{
+			Binance: BinanceConfig{Url: "wss://stream.binance.com:9443"},
+			Pyth:    PythConfig{Url: "https://hermes.pyth.network"},
+		},
+		Risk: RiskConfig{
+			MaxSpread:        0.1,
+			MaxExposureLimit: 1000000,
+		},
+		Watchdog: WatchdogConfig{
+			MarketDataStaleAfter: time.Second * 10,
+			OrdersStaleAfter:     time.Minute * 5,
+		},
+		Storage: StorageConfig{
+			JournalDir:       "data/journal",
+			JournalMaxSize:   100 * 1024 * 1024,
+			SnapshotPath:     "data/snapshot.json",
+			SnapshotInterval: time.Second * 30,
+		},
+		Treasury: TreasuryConfig{
+			Interval: time.Minute,
+			Assets:   make([]*TreasuryAssetConfig, 0),
+		},
+		Markets: make([]*store.MarketConfig, 0),
+	}
+}
+
+// Load reads the config file over the defaults and then applies any environment variable overrides.
+// Unknown keys are rejected so that typos do not silently fall back to defaults.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	config := NewDefaultConfig()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	err = config.applyEnv()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+type envOverride struct {
+	key   string
+	apply func(value string) error
+}
+
+func (c *Config) envOverrides() []envOverride {
+	return []envOverride{
+		{"VEGA_MM_CORE_NODE", setString(&c.Nodes.Core)},
+		{"VEGA_MM_API_ADDRESS", setString(&c.Api.Address)},
+		{"VEGA_MM_LOG_LEVEL", setString(&c.Logging.Level)},
+		{"VEGA_MM_SECRET", setString(&c.Secret.Path)},
+		{"VEGA_MM_SECRET_PASSPHRASE_FD", setInt(&c.Secret.PassphraseFd)},
+		{"VEGA_MM_SIGNER_BACKEND", func(value string) error {
+			c.Signer.Backend = SignerBackend(value)
+			return nil
+		}},
+		{"VEGA_MM_SIGNER_DERIVATION_PATH", setString(&c.Signer.DerivationPath)},
+		{"VEGA_MM_SIGNER_KEY_COUNT", setUint(&c.Signer.KeyCount)},
+		{"VEGA_MM_SIGNER_HEX_KEYS_PATH", setString(&c.Signer.HexKeysPath)},
+		{"VEGA_MM_SIGNER_REMOTE_URL", setString(&c.Signer.Remote.Url)},
+		{"VEGA_MM_SIGNER_REMOTE_WALLET", setString(&c.Signer.Remote.Wallet)},
+		{"VEGA_MM_SIGNER_REMOTE_TOKEN", setString(&c.Signer.Remote.Token)},
+		{"VEGA_MM_BINANCE_URL", setString(&c.PriceSources.Binance.Url)},
+		{"VEGA_MM_BINANCE_API_KEY", setString(&c.PriceSources.Binance.ApiKey)},
+		{"VEGA_MM_BINANCE_API_SECRET", setString(&c.PriceSources.Binance.ApiSecret)},
+		{"VEGA_MM_PYTH_URL", setString(&c.PriceSources.Pyth.Url)},
+		{"VEGA_MM_CHAINLINK_ETHEREUM_RPC_URL", setString(&c.PriceSources.Chainlink.EthereumRpcUrl)},
+		{"VEGA_MM_RISK_MAX_SPREAD", setFloat(&c.Risk.MaxSpread)},
+		{"VEGA_MM_RISK_MAX_EXPOSURE_LIMIT", setFloat(&c.Risk.MaxExposureLimit)},
+		{"VEGA_MM_WATCHDOG_MARKET_DATA_STALE_AFTER", setDuration(&c.Watchdog.MarketDataStaleAfter)},
+		{"VEGA_MM_WATCHDOG_ORDERS_STALE_AFTER", setDuration(&c.Watchdog.OrdersStaleAfter)},
+		{"VEGA_MM_STORAGE_JOURNAL_DIR", setString(&c.Storage.JournalDir)},
+		{"VEGA_MM_STORAGE_JOURNAL_MAX_SIZE", setInt(&c.Storage.JournalMaxSize)},
+		{"VEGA_MM_STORAGE_SNAPSHOT_PATH", setString(&c.Storage.SnapshotPath)},
+		{"VEGA_MM_STORAGE_SNAPSHOT_INTERVAL", setDuration(&c.Storage.SnapshotInterval)},
+	}
+}
+
+func (c *Config) applyEnv() error {
+	for _, override := range c.envOverrides() {
+		value, ok := os.LookupEnv(override.key)
+		if !ok {
+			continue
+		}
+		err := override.apply(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", override.key, err)
+		}
+	}
+	return nil
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func setFloat(target *float64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setInt[T int | int64](target *T) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*target = T(parsed)
+		return nil
+	}
+}
+
+func setUint(target *uint) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return err
+		}
+		*target = uint(parsed)
+		return nil
+	}
+}
+
+func setDuration(target *time.Duration) func(string) error {
+	return func(value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+// Validate checks the whole config. When live markets are given, each configured market must also exist on Vega
+// and be trading or in its opening auction; pass nil to only run the static checks.
+func (c *Config) Validate(liveMarkets []*vegapb.Market) *ValidationReport {
+	report := &ValidationReport{Issues: make([]*ValidationIssue, 0)}
+	if _, _, err := net.SplitHostPort(c.Nodes.Core); err != nil {
+		report.add("", "nodes.core", "%q must be a host:port address", c.Nodes.Core)
+	}
+	if _, _, err := net.SplitHostPort(c.Api.Address); err != nil {
+		report.add("", "api.address", "%q must be a host:port address", c.Api.Address)
+	}
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		report.add("", "logging.level", "%v", err)
+	}
+	c.validateSigner(report)
+	validateUrl(report, "priceSources.binance.url", c.PriceSources.Binance.Url)
+	validateUrl(report, "priceSources.pyth.url", c.PriceSources.Pyth.Url)
+	validateUrl(report, "priceSources.chainlink.ethereumRpcUrl", c.PriceSources.Chainlink.EthereumRpcUrl)
+	if c.Risk.MaxSpread <= 0 || c.Risk.MaxSpread > 1 {
+		report.add("", "risk.maxSpread", "%v must be greater than 0 and at most 1", c.Risk.MaxSpread)
+	}
+	if c.Risk.MaxExposureLimit <= 0 {
+		report.add("", "risk.maxExposureLimit", "%v must be greater than 0", c.Risk.MaxExposureLimit)
+	}
+	if c.Watchdog.MarketDataStaleAfter <= 0 {
+		report.add("", "watchdog.marketDataStaleAfter", "%v must be greater than 0", c.Watchdog.MarketDataStaleAfter)
+	}
+	if c.Watchdog.OrdersStaleAfter < 0 {
+		report.add("", "watchdog.ordersStaleAfter", "%v must not be negative", c.Watchdog.OrdersStaleAfter)
+	}
+	if len(c.Storage.JournalDir) == 0 {
+		report.add("", "storage.journalDir", "must not be empty")
+	}
+	if c.Storage.JournalMaxSize <= 0 {
+		report.add("", "storage.journalMaxSize", "%d must be greater than 0", c.Storage.JournalMaxSize)
+	}
+	if len(c.Storage.SnapshotPath) == 0 {
+		report.add("", "storage.snapshotPath", "must not be empty")
+	}
+	if c.Storage.SnapshotInterval <= 0 {
+		report.add("", "storage.snapshotInterval", "%v must be greater than 0", c.Storage.SnapshotInterval)
+	}
+	c.validateTreasury(report)
+	validateMarkets(report, c.Markets, &c.Risk, liveMarkets)
+	return report
+}
+
+func (c *Config) validateTreasury(report *ValidationReport) {
+	if !c.Treasury.Enabled {
+		return
+	}
+	for _, market := range c.Markets {
+		if market.KeyIndex != nil && *market.KeyIndex == c.Treasury.FundingKeyIndex {
+			report.add(market.VegaId, "keyIndex", "%d is the treasury funding key", *market.KeyIndex)
+		}
+	}
+	if (c.Signer.Backend == KeystoreSigner || c.Signer.Backend == MnemonicSigner) &&
+		c.Treasury.FundingKeyIndex >= c.Signer.KeyCount {
+		report.add("", "treasury.fundingKeyIndex", "%d is outside the %d key(s) derived by signer.keyCount",
+			c.Treasury.FundingKeyIndex, c.Signer.KeyCount)
+	}
+	if c.Treasury.Interval <= 0 {
+		report.add("", "treasury.interval", "%v must be greater than 0", c.Treasury.Interval)
+	}
+	if len(c.Treasury.Assets) == 0 {
+		report.add("", "treasury.assets", "at least one asset must be configured")
+	}
+	seen := map[string]bool{}
+	for i, asset := range c.Treasury.Assets {
+		field := fmt.Sprintf("treasury.assets[%d]", i)
+		if len(asset.AssetId) == 0 {
+			report.add("", field+".assetId", "must not be empty")
+		} else if seen[asset.AssetId] {
+			report.add("", field+".assetId", "duplicate asset %s", asset.AssetId)
+		}
+		seen[asset.AssetId] = true
+		if asset.MinBalance < 0 || asset.MinBalance > asset.TargetBalance || asset.TargetBalance > asset.MaxBalance {
+			report.add("", field, "balances must satisfy 0 <= minBalance (%v) <= targetBalance (%v) <= maxBalance (%v)",
+				asset.MinBalance, asset.TargetBalance, asset.MaxBalance)
+		}
+		if asset.DailyLimit <= 0 {
+			report.add("", field+".dailyLimit", "%v must be greater than 0", asset.DailyLimit)
+		}
+	}
+}
+
+// ValidateMarkets checks a market list against the risk limits in this config
+func (c *Config) ValidateMarkets(markets []*store.MarketConfig, liveMarkets []*vegapb.Market) *ValidationReport {
+	report := &ValidationReport{Issues: make([]*ValidationIssue, 0)}
+	validateMarkets(report, markets, &c.Risk, liveMarkets)
+	return report
+}
+
+func (c *Config) validateSigner(report *ValidationReport) {
+	if c.Signer.Backend == KeystoreSigner || c.Signer.Backend == MnemonicSigner {
+		if err := auth.ValidateDerivationPath(c.Signer.DerivationPath); err != nil {
+			report.add("", "signer.derivationPath", "%v", err)
+		}
+		for _, market := range c.Markets {
+			if market.KeyIndex != nil && *market.KeyIndex >= c.Signer.KeyCount {
+				report.add(market.VegaId, "keyIndex", "%d is outside the %d key(s) derived by signer.keyCount",
+					*market.KeyIndex, c.Signer.KeyCount)
+			}
+		}
+	}
+	switch c.Signer.Backend {
+	case KeystoreSigner:
+		if len(c.Secret.Path) == 0 {
+			report.add("", "secret.path", "must not be empty")
+		}
+		if c.Secret.PassphraseFd < -1 {
+			report.add("", "secret.passphraseFd", "%d must be a file descriptor, or -1 for none",
+				c.Secret.PassphraseFd)
+		}
+	case MnemonicSigner:
+		if len(c.Signer.MnemonicEnv) == 0 {
+			report.add("", "signer.mnemonicEnv", "must not be empty")
+		}
+	case HexKeysSigner:
+		if len(c.Signer.HexKeysPath) == 0 {
+			report.add("", "signer.hexKeysPath", "must not be empty")
+		}
+	case RemoteSigner:
+		if len(c.Signer.Remote.Url) == 0 {
+			report.add("", "signer.remote.url", "must not be empty")
+		}
+		validateUrl(report, "signer.remote.url", c.Signer.Remote.Url)
+		if len(c.Signer.Remote.Wallet) == 0 {
+			report.add("", "signer.remote.wallet", "must not be empty")
+		}
+		if c.Signer.Remote.Timeout <= 0 {
+			report.add("", "signer.remote.timeout", "%v must be greater than 0", c.Signer.Remote.Timeout)
+		}
+	default:
+		report.add("", "signer.backend", "unknown signer backend %q, expected one of %v",
+			c.Signer.Backend, signerBackends)
+	}
+}
+
+func validateUrl(report *ValidationReport, field string, value string) {
+	if len(value) == 0 {
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || len(parsed.Scheme) == 0 || len(parsed.Host) == 0 {
+		report.add("", field, "%q must be an absolute URL", value)
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"fmt"
+	"strings"
+	"vega-cli-mm/store"
+)
+
+var priceSources = []store.PriceSource{store.Binance, store.Pyth, store.Chainlink}
+
+type ValidationIssue struct {
+	MarketId string `json:"marketId"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+type ValidationReport struct {
+	Issues []*ValidationIssue `json:"issues"`
+}
+
+func (r *ValidationReport) add(marketId string, field string, message string, args ...any) {
+	r.Issues = append(r.Issues, &ValidationIssue{
+		MarketId: marketId,
+		Field:    field,
+		Message:  fmt.Sprintf(message, args...),
+	})
+}
+
+func (r *ValidationReport) IsValid() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *ValidationReport) String() string {
+	if r.IsValid() {
+		return "config is valid"
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("config has %d issue(s):", len(r.Issues)))
+	for _, issue := range r.Issues {
+		if len(issue.MarketId) > 0 {
+			sb.WriteString(fmt.Sprintf("\n  market %q, %s: %s", issue.MarketId, issue.Field, issue.Message))
+		} else {
+			sb.WriteString(fmt.Sprintf("\n  %s: %s", issue.Field, issue.Message))
+		}
+	}
+	return sb.String()
+}
+
+func validateMarkets(
+	report *ValidationReport,
+	markets []*store.MarketConfig,
+	risk *RiskConfig,
+	liveMarkets []*vegapb.Market,
+) {
+	if len(markets) == 0 {
+		report.add("", "markets", "at least one market must be configured")
+	}
+	seen := map[string]bool{}
+	seenKeys := map[uint]string{}
+	var liveMarketsById map[string]*vegapb.Market
+	if liveMarkets != nil {
+		liveMarketsById = map[string]*vegapb.Market{}
+		for _, market := range liveMarkets {
+			liveMarketsById[market.Id] = market
+		}
+	}
+	for _, market := range markets {
+		if len(market.VegaId) == 0 {
+			report.add(market.VegaId, "vegaId", "must not be empty")
+		} else if seen[market.VegaId] {
+			report.add(market.VegaId, "vegaId", "duplicate market")
+		}
+		seen[market.VegaId] = true
+		if len(market.ExternalId) == 0 {
+			report.add(market.VegaId, "externalId", "must not be empty")
+		}
+		if !isKnownPriceSource(market.PriceSource) {
+			report.add(market.VegaId, "priceSource", "unknown price source %q, expected one of %v",
+				market.PriceSource, priceSources)
+		}
+		if market.Spread <= 0 || market.Spread > risk.MaxSpread {
+			report.add(market.VegaId, "spread", "%v must be greater than 0 and at most %v",
+				market.Spread, risk.MaxSpread)
+		}
+		if market.ExposureLimit <= 0 || market.ExposureLimit > risk.MaxExposureLimit {
+			report.add(market.VegaId, "exposureLimit", "%v must be greater than 0 and at most %v",
+				market.ExposureLimit, risk.MaxExposureLimit)
+		}
+		if market.LpRatio < 0 || market.LpRatio > 1 {
+			report.add(market.VegaId, "lpRatio", "%v must be between 0 and 1", market.LpRatio)
+		}
+		if market.KeyIndex == nil {
+			report.add(market.VegaId, "keyIndex", "must be set")
+		} else if other, ok := seenKeys[*market.KeyIndex]; ok {
+			report.add(market.VegaId, "keyIndex", "key %d is already used by market %q", *market.KeyIndex, other)
+		} else {
+			seenKeys[*market.KeyIndex] = market.VegaId
+		}
+		if liveMarketsById == nil || len(market.VegaId) == 0 {
+			continue
+		}
+		liveMarket := liveMarketsById[market.VegaId]
+		if liveMarket == nil {
+			report.add(market.VegaId, "vegaId", "market does not exist on Vega")
+		} else if liveMarket.State != vegapb.Market_STATE_ACTIVE && liveMarket.State != vegapb.Market_STATE_PENDING {
+			report.add(market.VegaId, "vegaId", "market is %s, expected it to be trading or in opening auction",
+				liveMarket.State)
+		}
+	}
+}
+
+func isKnownPriceSource(priceSource store.PriceSource) bool {
+	for _, known := range priceSources {
+		if priceSource == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package funding
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	eventspb "code.vegaprotocol.io/vega/protos/vega/events/v1"
+	"github.com/shopspring/decimal"
+	"vega-cli-mm/store"
+)
+
+type EventType string
+
+const (
+	Deposit    EventType = "deposit"
+	Withdrawal EventType = "withdrawal"
+	// TransferIn and TransferOut are Vega transfers to and from the key's general account, such as treasury top ups
+	// and sweeps
+	TransferIn  EventType = "transferIn"
+	TransferOut EventType = "transferOut"
+)
+
+type Event struct {
+	Type        EventType       `json:"type"`
+	Id          string          `json:"id"`
+	AssetId     string          `json:"assetId"`
+	Amount      decimal.Decimal `json:"amount"`
+	Status      string          `json:"status"`
+	TxHash      string          `json:"txHash"`
+	CreatedAt   int64           `json:"createdAt"`
+	CompletedAt int64           `json:"completedAt"`
+}
+
+// PartyFunding totals deposits once they are credited, withdrawals once they are accepted and transfers once they
+// are done, which is when each moves the general account balance, so that Net can be subtracted from a balance
+// change to leave trading PnL
+type PartyFunding struct {
+	PartyId        string                     `json:"partyId"`
+	Deposited      map[string]decimal.Decimal `json:"deposited"`
+	Withdrawn      map[string]decimal.Decimal `json:"withdrawn"`
+	TransferredIn  map[string]decimal.Decimal `json:"transferredIn"`
+	TransferredOut map[string]decimal.Decimal `json:"transferredOut"`
+	Net            map[string]decimal.Decimal `json:"net"`
+	Events         []*Event                   `json:"events"`
+}
+
+type Funding struct {
+	store *store.Store
+}
+
+func NewFunding(
+	store *store.Store,
+) *Funding {
+	return &Funding{
+		store: store,
+	}
+}
+
+func (f *Funding) GetFunding() []*PartyFunding {
+	seen := map[string]bool{}
+	result := make([]*PartyFunding, 0)
+	for _, config := range f.store.GetMarketConfig() {
+		partyId := config.KeyPair.PublicKey
+		if seen[partyId] {
+			continue
+		}
+		seen[partyId] = true
+		result = append(result, f.getPartyFunding(partyId))
+	}
+	return result
+}
+
+func (f *Funding) getPartyFunding(partyId string) *PartyFunding {
+	result := &PartyFunding{
+		PartyId:        partyId,
+		Deposited:      map[string]decimal.Decimal{},
+		Withdrawn:      map[string]decimal.Decimal{},
+		TransferredIn:  map[string]decimal.Decimal{},
+		TransferredOut: map[string]decimal.Decimal{},
+		Net:            map[string]decimal.Decimal{},
+		Events:         make([]*Event, 0),
+	}
+	for _, deposit := range f.store.GetDeposits(partyId) {
+		amount := f.store.ToAssetUnits(deposit.Asset, deposit.Amount)
+		result.Events = append(result.Events, &Event{
+			Type:        Deposit,
+			Id:          deposit.Id,
+			AssetId:     deposit.Asset,
+			Amount:      amount,
+			Status:      deposit.Status.String(),
+			TxHash:      deposit.TxHash,
+			CreatedAt:   deposit.CreatedTimestamp,
+			CompletedAt: deposit.CreditedTimestamp,
+		})
+		if deposit.Status == vegapb.Deposit_STATUS_FINALIZED {
+			result.Deposited[deposit.Asset] = result.Deposited[deposit.Asset].Add(amount)
+			result.Net[deposit.Asset] = result.Net[deposit.Asset].Add(amount)
+		}
+	}
+	for _, withdrawal := range f.store.GetWithdrawals(partyId) {
+		amount := f.store.ToAssetUnits(withdrawal.Asset, withdrawal.Amount)
+		result.Events = append(result.Events, &Event{
+			Type:        Withdrawal,
+			Id:          withdrawal.Id,
+			AssetId:     withdrawal.Asset,
+			Amount:      amount,
+			Status:      withdrawal.Status.String(),
+			TxHash:      withdrawal.TxHash,
+			CreatedAt:   withdrawal.CreatedTimestamp,
+			CompletedAt: withdrawal.WithdrawnTimestamp,
+		})
+		if withdrawal.Status != vegapb.Withdrawal_STATUS_REJECTED {
+			result.Withdrawn[withdrawal.Asset] = result.Withdrawn[withdrawal.Asset].Add(amount)
+			result.Net[withdrawal.Asset] = result.Net[withdrawal.Asset].Sub(amount)
+		}
+	}
+	for _, transfer := range f.store.GetTransfers(partyId) {
+		in := transfer.To == partyId && transfer.ToAccountType == vegapb.AccountType_ACCOUNT_TYPE_GENERAL
+		out := transfer.From == partyId && transfer.FromAccountType == vegapb.AccountType_ACCOUNT_TYPE_GENERAL
+		if in == out {
+			// not to or from the general account, or a transfer to itself that leaves the balance unchanged
+			continue
+		}
+		amount := f.store.ToAssetUnits(transfer.Asset, transfer.Amount)
+		event := &Event{
+			Type:      TransferOut,
+			Id:        transfer.Id,
+			AssetId:   transfer.Asset,
+			Amount:    amount,
+			Status:    transfer.Status.String(),
+			CreatedAt: transfer.Timestamp,
+		}
+		if in {
+			event.Type = TransferIn
+		}
+		result.Events = append(result.Events, event)
+		if transfer.Status != eventspb.Transfer_STATUS_DONE {
+			continue
+		}
+		event.CompletedAt = transfer.Timestamp
+		if in {
+			result.TransferredIn[transfer.Asset] = result.TransferredIn[transfer.Asset].Add(amount)
+			result.Net[transfer.Asset] = result.Net[transfer.Asset].Add(amount)
+		} else {
+			result.TransferredOut[transfer.Asset] = result.TransferredOut[transfer.Asset].Add(amount)
+			result.Net[transfer.Asset] = result.Net[transfer.Asset].Sub(amount)
+		}
+	}
+	return result
+}
@@ -12,7 +12,10 @@ require (
 	github.com/withmandala/go-log v0.1.0
 	golang.org/x/crypto v0.12.0
 	golang.org/x/exp v0.0.0-20230807204917-050eac23e9de
+	golang.org/x/term v0.11.0
 	google.golang.org/grpc v1.57.0
+	google.golang.org/protobuf v1.30.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -23,10 +26,8 @@ require (
 	github.com/smartystreets/goconvey v1.8.1 // indirect
 	golang.org/x/net v0.10.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
-	golang.org/x/term v0.11.0 // indirect
 	golang.org/x/text v0.12.0 // indirect
 	google.golang.org/genproto v0.0.0-20230526161137-0005af68ea54 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20230525234035-dd9d682886f9 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
 )
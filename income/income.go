@@ -0,0 +1,169 @@
+package income
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+	"vega-cli-mm/store"
+)
+
+type EpochIncome struct {
+	Epoch         uint64                     `json:"epoch"`
+	LiquidityFees decimal.Decimal            `json:"liquidityFees"`
+	BondSlashed   decimal.Decimal            `json:"bondSlashed"`
+	Rewards       map[string]decimal.Decimal `json:"rewards"`
+}
+
+type RewardTotal struct {
+	Type    string          `json:"type"`
+	AssetId string          `json:"assetId"`
+	Amount  decimal.Decimal `json:"amount"`
+}
+
+type MarketIncome struct {
+	MarketId      string                     `json:"marketId"`
+	AssetId       string                     `json:"assetId"`
+	BondBalance   decimal.Decimal            `json:"bondBalance"`
+	LiquidityFees decimal.Decimal            `json:"liquidityFees"`
+	BondSlashed   decimal.Decimal            `json:"bondSlashed"`
+	Rewards       map[string]decimal.Decimal `json:"rewards"`
+	RewardTotals  []*RewardTotal             `json:"rewardTotals"`
+	Epochs        []*EpochIncome             `json:"epochs"`
+}
+
+type KeyIncome struct {
+	PartyId string          `json:"partyId"`
+	Markets []*MarketIncome `json:"markets"`
+}
+
+type Income struct {
+	store *store.Store
+}
+
+func NewIncome(
+	store *store.Store,
+) *Income {
+	return &Income{
+		store: store,
+	}
+}
+
+func (i *Income) GetIncome() []*KeyIncome {
+	byKey := map[string]*KeyIncome{}
+	result := make([]*KeyIncome, 0)
+	for _, config := range i.store.GetMarketConfig() {
+		partyId := config.KeyPair.PublicKey
+		marketIncome := i.getMarketIncome(config.VegaId, partyId)
+		if marketIncome == nil {
+			continue
+		}
+		keyIncome := byKey[partyId]
+		if keyIncome == nil {
+			keyIncome = &KeyIncome{PartyId: partyId, Markets: make([]*MarketIncome, 0)}
+			byKey[partyId] = keyIncome
+			result = append(result, keyIncome)
+		}
+		keyIncome.Markets = append(keyIncome.Markets, marketIncome)
+	}
+	return result
+}
+
+// getMarketIncome attributes liquidity fee distributions and bond slashing for the key to the epoch in which they
+// happened, and rewards paid to the key to the epoch they were paid for. Anything that falls outside the epochs we
+// know about only counts towards the totals.
+func (i *Income) getMarketIncome(marketId string, partyId string) *MarketIncome {
+	market := i.store.GetMarket(marketId)
+	if market == nil {
+		return nil
+	}
+	assetId := market.GetTradableInstrument().GetInstrument().GetFuture().GetSettlementAsset()
+	if i.store.GetAsset(assetId) == nil {
+		return nil
+	}
+	result := &MarketIncome{
+		MarketId:      marketId,
+		AssetId:       assetId,
+		BondBalance:   decimal.Zero,
+		LiquidityFees: decimal.Zero,
+		BondSlashed:   decimal.Zero,
+		Rewards:       map[string]decimal.Decimal{},
+		RewardTotals:  make([]*RewardTotal, 0),
+		Epochs:        make([]*EpochIncome, 0),
+	}
+	for _, account := range i.store.GetAccounts(marketId, vegapb.AccountType_ACCOUNT_TYPE_BOND) {
+		if account.Owner == partyId {
+			result.BondBalance = i.store.ToAssetUnits(account.Asset, account.Balance)
+		}
+	}
+	epochs := i.store.GetEpochs()
+	byEpoch := map[uint64]*EpochIncome{}
+	getEpochIncome := func(epoch *vegapb.Epoch) *EpochIncome {
+		if epoch == nil {
+			return nil
+		}
+		epochIncome := byEpoch[epoch.Seq]
+		if epochIncome == nil {
+			epochIncome = &EpochIncome{
+				Epoch:         epoch.Seq,
+				LiquidityFees: decimal.Zero,
+				BondSlashed:   decimal.Zero,
+				Rewards:       map[string]decimal.Decimal{},
+			}
+			byEpoch[epoch.Seq] = epochIncome
+			result.Epochs = append(result.Epochs, epochIncome)
+		}
+		return epochIncome
+	}
+	for _, entry := range i.store.GetLedgerEntries(vegapb.TransferType_TRANSFER_TYPE_LIQUIDITY_FEE_DISTRIBUTE) {
+		if entry.GetToAccountPartyId() != partyId || entry.GetFromAccountMarketId() != marketId {
+			continue
+		}
+		amount := i.store.ToAssetUnits(entry.GetAssetId(), entry.Quantity)
+		result.LiquidityFees = result.LiquidityFees.Add(amount)
+		if epochIncome := getEpochIncome(findEpoch(epochs, entry.Timestamp)); epochIncome != nil {
+			epochIncome.LiquidityFees = epochIncome.LiquidityFees.Add(amount)
+		}
+	}
+	for _, entry := range i.store.GetLedgerEntries(vegapb.TransferType_TRANSFER_TYPE_BOND_SLASHING) {
+		if entry.GetFromAccountPartyId() != partyId || entry.GetFromAccountMarketId() != marketId {
+			continue
+		}
+		amount := i.store.ToAssetUnits(entry.GetAssetId(), entry.Quantity)
+		result.BondSlashed = result.BondSlashed.Add(amount)
+		if epochIncome := getEpochIncome(findEpoch(epochs, entry.Timestamp)); epochIncome != nil {
+			epochIncome.BondSlashed = epochIncome.BondSlashed.Add(amount)
+		}
+	}
+	byType := map[string]*RewardTotal{}
+	for _, reward := range i.store.GetRewards(partyId) {
+		if reward.MarketId != marketId {
+			continue
+		}
+		amount := i.store.ToAssetUnits(reward.AssetId, reward.Amount)
+		result.Rewards[reward.AssetId] = result.Rewards[reward.AssetId].Add(amount)
+		total := byType[reward.RewardType+reward.AssetId]
+		if total == nil {
+			total = &RewardTotal{Type: reward.RewardType, AssetId: reward.AssetId, Amount: decimal.Zero}
+			byType[reward.RewardType+reward.AssetId] = total
+			result.RewardTotals = append(result.RewardTotals, total)
+		}
+		total.Amount = total.Amount.Add(amount)
+		if epochIncome := getEpochIncome(i.store.GetEpoch(reward.Epoch)); epochIncome != nil {
+			epochIncome.Rewards[reward.AssetId] = epochIncome.Rewards[reward.AssetId].Add(amount)
+		}
+	}
+	return result
+}
+
+func findEpoch(epochs []*vegapb.Epoch, timestamp int64) *vegapb.Epoch {
+	for _, epoch := range epochs {
+		if epoch.Timestamps == nil {
+			continue
+		}
+		started := epoch.Timestamps.StartTime <= timestamp
+		ended := epoch.Timestamps.EndTime > 0 && epoch.Timestamps.EndTime <= timestamp
+		if started && !ended {
+			return epoch
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package inventory
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"sort"
+	"vega-cli-mm/auth"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/store"
+)
+
+type AssetBalance struct {
+	AssetId string          `json:"assetId"`
+	Symbol  string          `json:"symbol"`
+	General decimal.Decimal `json:"general"`
+	Margin  decimal.Decimal `json:"margin"`
+	Bond    decimal.Decimal `json:"bond"`
+}
+
+type KeyInventory struct {
+	KeyIndex  uint            `json:"keyIndex"`
+	PublicKey string          `json:"publicKey"`
+	MarketId  string          `json:"marketId"`
+	Balances  []*AssetBalance `json:"balances"`
+}
+
+type Inventory struct {
+	store  *store.Store
+	signer auth.Signer
+}
+
+func NewInventory(
+	store *store.Store,
+	signer auth.Signer,
+) *Inventory {
+	return &Inventory{
+		store:  store,
+		signer: signer,
+	}
+}
+
+// GetInventory lists every key the signer holds, in key index order, with the market assigned to it and its
+// balances from the store. Keys without a market are included so that idle collateral is visible too.
+func (i *Inventory) GetInventory() []*KeyInventory {
+	keys, err := i.signer.Keys()
+	if err != nil {
+		logging.GetLogger().Warnf("could not list keys: %v", err)
+		return make([]*KeyInventory, 0)
+	}
+	marketIds := map[uint]string{}
+	for _, config := range i.store.GetMarketConfig() {
+		marketIds[*config.KeyIndex] = config.VegaId
+	}
+	indexes := maps.Keys(keys)
+	slices.Sort(indexes)
+	result := make([]*KeyInventory, 0, len(keys))
+	for _, idx := range indexes {
+		result = append(result, &KeyInventory{
+			KeyIndex:  idx,
+			PublicKey: keys[idx].PublicKey,
+			MarketId:  marketIds[idx],
+			Balances:  i.getBalances(keys[idx].PublicKey),
+		})
+	}
+	return result
+}
+
+func (i *Inventory) getBalances(partyId string) []*AssetBalance {
+	byAsset := map[string]*AssetBalance{}
+	result := make([]*AssetBalance, 0)
+	for _, account := range i.store.GetPartyAccounts(partyId) {
+		balance := byAsset[account.Asset]
+		if balance == nil {
+			balance = &AssetBalance{
+				AssetId: account.Asset,
+				General: decimal.Zero,
+				Margin:  decimal.Zero,
+				Bond:    decimal.Zero,
+			}
+			if asset := i.store.GetAsset(account.Asset); asset != nil {
+				balance.Symbol = asset.Details.Symbol
+			}
+			byAsset[account.Asset] = balance
+			result = append(result, balance)
+		}
+		amount := i.store.ToAssetUnits(account.Asset, account.Balance)
+		switch account.Type {
+		case vegapb.AccountType_ACCOUNT_TYPE_GENERAL:
+			balance.General = balance.General.Add(amount)
+		case vegapb.AccountType_ACCOUNT_TYPE_MARGIN:
+			balance.Margin = balance.Margin.Add(amount)
+		case vegapb.AccountType_ACCOUNT_TYPE_BOND:
+			balance.Bond = balance.Bond.Add(amount)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AssetId < result[j].AssetId
+	})
+	return result
+}
@@ -0,0 +1,147 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sasha-s/go-deadlock"
+	"github.com/shopspring/decimal"
+	"os"
+	"path/filepath"
+	"time"
+	"vega-cli-mm/logging"
+)
+
+type EventType string
+
+const (
+	Order          EventType = "order"
+	Fill           EventType = "fill"
+	Transaction    EventType = "transaction"
+	ReferencePrice EventType = "referencePrice"
+)
+
+const fileName = "journal.ndjson"
+
+type Event struct {
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+	Data any       `json:"data"`
+}
+
+type TransactionRecord struct {
+	PubKey  string `json:"pubKey"`
+	Tid     string `json:"tid"`
+	TxHash  string `json:"txHash,omitempty"`
+	Success bool   `json:"success"`
+	Code    uint32 `json:"code,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ReferencePriceSample struct {
+	MarketId string          `json:"marketId"`
+	BidPrice decimal.Decimal `json:"bidPrice"`
+	AskPrice decimal.Decimal `json:"askPrice"`
+}
+
+// Journal is an append-only, newline-delimited JSON log of everything the bot observed and did. The active file is
+// rotated to a timestamped name once it grows beyond the configured size.
+type Journal struct {
+	dir     string
+	maxSize int64
+	file    *os.File
+	size    int64
+	mu      deadlock.Mutex
+}
+
+func NewJournal(
+	dir string,
+	maxSize int64,
+) *Journal {
+	journal := &Journal{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		logging.Panic(fmt.Sprintf("error creating journal directory: %v", err))
+	}
+	err = journal.open()
+	if err != nil {
+		logging.Panic(fmt.Sprintf("error opening journal: %v", err))
+	}
+	return journal
+}
+
+func (j *Journal) open() error {
+	file, err := os.OpenFile(filepath.Join(j.dir, fileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	j.file = file
+	j.size = info.Size()
+	return nil
+}
+
+func (j *Journal) rotate() error {
+	err := j.file.Close()
+	j.file = nil
+	if err != nil {
+		return err
+	}
+	rotatedName := fmt.Sprintf("journal-%s.ndjson", time.Now().UTC().Format("20060102T150405.000000000"))
+	err = os.Rename(filepath.Join(j.dir, fileName), filepath.Join(j.dir, rotatedName))
+	if err != nil {
+		return err
+	}
+	return j.open()
+}
+
+func (j *Journal) Record(eventType EventType, data any) {
+	if j == nil {
+		return
+	}
+	line, err := json.Marshal(&Event{Time: time.Now().UTC(), Type: eventType, Data: data})
+	if err != nil {
+		logging.GetLogger().Warnf("could not encode journal event: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return
+	}
+	if j.size > 0 && j.size+int64(len(line)) > j.maxSize {
+		err = j.rotate()
+		if err != nil {
+			logging.GetLogger().Errorf("could not rotate journal: %v", err)
+		}
+		if j.file == nil && j.open() != nil {
+			return
+		}
+	}
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		logging.GetLogger().Errorf("could not write journal event: %v", err)
+	}
+}
+
+func (j *Journal) Close() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return
+	}
+	err := j.file.Close()
+	if err != nil {
+		logging.GetLogger().Warnf("could not close journal: %v", err)
+	}
+	j.file = nil
+}
@@ -1,16 +1,48 @@
 package logging
 
 import (
+	"fmt"
 	"github.com/withmandala/go-log"
 	"os"
 )
 
+type Level string
+
+const (
+	Debug Level = "debug"
+	Info  Level = "info"
+	Quiet Level = "quiet"
+)
+
+var level = Info
+
+func ParseLevel(value string) (Level, error) {
+	switch Level(value) {
+	case Debug, Info, Quiet:
+		return Level(value), nil
+	default:
+		return "", fmt.Errorf("unknown log level %q, expected one of %s, %s or %s", value, Debug, Info, Quiet)
+	}
+}
+
+func SetLevel(value string) error {
+	parsed, err := ParseLevel(value)
+	if err != nil {
+		return err
+	}
+	level = parsed
+	return nil
+}
+
 func GetLogger() *log.Logger {
-	if os.Getenv("DEBUG") == "1" {
-		return log.New(os.Stderr).WithDebug().WithColor()
-	} else {
-		return log.New(os.Stderr).WithColor()
+	logger := log.New(os.Stderr).WithColor()
+	if level == Debug || os.Getenv("DEBUG") == "1" {
+		logger = logger.WithDebug()
+	}
+	if level == Quiet {
+		logger = logger.Quiet()
 	}
+	return logger
 }
 
 func Panic(message string) {
@@ -0,0 +1,118 @@
+package pnl
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+	"time"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/store"
+)
+
+type MarketPnl struct {
+	MarketId           string          `json:"marketId"`
+	PartyId            string          `json:"partyId"`
+	AssetId            string          `json:"assetId"`
+	RealisedPnl        decimal.Decimal `json:"realisedPnl"`
+	UnrealisedPnl      decimal.Decimal `json:"unrealisedPnl"`
+	SpreadCapture      decimal.Decimal `json:"spreadCapture"`
+	InventoryPnl       decimal.Decimal `json:"inventoryPnl"`
+	MakerFeeRebates    decimal.Decimal `json:"makerFeeRebates"`
+	LiquidityFeeIncome decimal.Decimal `json:"liquidityFeeIncome"`
+	FeesPaid           decimal.Decimal `json:"feesPaid"`
+	Total              decimal.Decimal `json:"total"`
+}
+
+type Pnl struct {
+	store *store.Store
+}
+
+func NewPnl(
+	store *store.Store,
+) *Pnl {
+	return &Pnl{
+		store: store,
+	}
+}
+
+func (p *Pnl) Start() {
+	go func() {
+		for range time.NewTicker(time.Minute).C {
+			for _, marketPnl := range p.GetPnl() {
+				logging.GetLogger().Infof(
+					"pnl for market %s and party %s: total = %s; realised = %s; unrealised = %s; spread = %s; "+
+						"inventory = %s; maker rebates = %s; liquidity fees = %s; fees paid = %s",
+					marketPnl.MarketId, marketPnl.PartyId, marketPnl.Total, marketPnl.RealisedPnl,
+					marketPnl.UnrealisedPnl, marketPnl.SpreadCapture, marketPnl.InventoryPnl,
+					marketPnl.MakerFeeRebates, marketPnl.LiquidityFeeIncome, marketPnl.FeesPaid,
+				)
+			}
+		}
+	}()
+}
+
+func (p *Pnl) GetPnl() []*MarketPnl {
+	result := make([]*MarketPnl, 0)
+	for _, config := range p.store.GetMarketConfig() {
+		marketPnl := p.getMarketPnl(config.VegaId, config.KeyPair.PublicKey)
+		if marketPnl != nil {
+			result = append(result, marketPnl)
+		}
+	}
+	return result
+}
+
+// getMarketPnl splits the trading PnL reported by Vega into the edge captured against the mid price at the
+// time of each trade and the remainder, which is the result of carrying inventory. Fees are accounted separately.
+// All values are converted to asset units; nil is returned until the market and asset are known.
+func (p *Pnl) getMarketPnl(marketId string, partyId string) *MarketPnl {
+	market := p.store.GetMarket(marketId)
+	if market == nil {
+		return nil
+	}
+	future := market.GetTradableInstrument().GetInstrument().GetFuture()
+	asset := p.store.GetAsset(future.GetSettlementAsset())
+	if asset == nil {
+		return nil
+	}
+	priceFactor := decimal.New(1, int32(market.DecimalPlaces))
+	sizeFactor := decimal.New(1, int32(market.PositionDecimalPlaces))
+	result := &MarketPnl{
+		MarketId:           marketId,
+		PartyId:            partyId,
+		AssetId:            asset.Id,
+		RealisedPnl:        decimal.Zero,
+		UnrealisedPnl:      decimal.Zero,
+		SpreadCapture:      decimal.Zero,
+		InventoryPnl:       decimal.Zero,
+		MakerFeeRebates:    decimal.Zero,
+		LiquidityFeeIncome: decimal.Zero,
+		FeesPaid:           decimal.Zero,
+	}
+	position := p.store.GetPosition(marketId, partyId)
+	if position != nil {
+		result.RealisedPnl = p.store.ToAssetUnits(asset.Id, position.RealisedPnl)
+		result.UnrealisedPnl = p.store.ToAssetUnits(asset.Id, position.UnrealisedPnl)
+	}
+	for _, fill := range p.store.GetFills(marketId, partyId) {
+		if !fill.MidPrice.IsZero() {
+			edge := fill.MidPrice.Sub(fill.Price)
+			if fill.Side == vegapb.Side_SIDE_SELL {
+				edge = edge.Neg()
+			}
+			size := decimal.NewFromInt(int64(fill.Size)).Div(sizeFactor)
+			result.SpreadCapture = result.SpreadCapture.Add(edge.Div(priceFactor).Mul(size))
+		}
+		result.MakerFeeRebates = result.MakerFeeRebates.Add(p.store.DecimalToAssetUnits(asset.Id, fill.MakerFeeReceived))
+		feesPaid := fill.MakerFee.Add(fill.InfrastructureFee).Add(fill.LiquidityFee)
+		result.FeesPaid = result.FeesPaid.Add(p.store.DecimalToAssetUnits(asset.Id, feesPaid))
+	}
+	for _, entry := range p.store.GetLedgerEntries(vegapb.TransferType_TRANSFER_TYPE_LIQUIDITY_FEE_DISTRIBUTE) {
+		if entry.GetToAccountPartyId() == partyId && entry.GetFromAccountMarketId() == marketId {
+			result.LiquidityFeeIncome = result.LiquidityFeeIncome.Add(p.store.ToAssetUnits(asset.Id, entry.Quantity))
+		}
+	}
+	tradingPnl := result.RealisedPnl.Add(result.UnrealisedPnl)
+	result.InventoryPnl = tradingPnl.Sub(result.SpreadCapture)
+	result.Total = tradingPnl.Add(result.MakerFeeRebates).Add(result.LiquidityFeeIncome).Sub(result.FeesPaid)
+	return result
+}
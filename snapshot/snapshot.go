@@ -0,0 +1,220 @@
+package snapshot
+
+import (
+	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"os"
+	"path/filepath"
+	"time"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/store"
+)
+
+// snapshotFile is the on-disk format. Vega types are encoded with protojson because their oneof fields
+// cannot be decoded by encoding/json.
+type snapshotFile struct {
+	Time                time.Time         `json:"time"`
+	Accounts            []json.RawMessage `json:"accounts"`
+	Assets              []json.RawMessage `json:"assets"`
+	Positions           []json.RawMessage `json:"positions"`
+	Orders              []json.RawMessage `json:"orders"`
+	MarketData          []json.RawMessage `json:"marketData"`
+	Markets             []json.RawMessage `json:"markets"`
+	LiquidityProvisions []json.RawMessage `json:"liquidityProvisions"`
+	NetworkParameters   []json.RawMessage `json:"networkParameters"`
+	LedgerEntries       []json.RawMessage `json:"ledgerEntries"`
+	Epochs              []json.RawMessage `json:"epochs"`
+	Rewards             []json.RawMessage `json:"rewards"`
+	Fills               []*store.Fill     `json:"fills"`
+}
+
+type Snapshotter struct {
+	store    *store.Store
+	path     string
+	interval time.Duration
+}
+
+func NewSnapshotter(
+	store *store.Store,
+	path string,
+	interval time.Duration,
+) *Snapshotter {
+	return &Snapshotter{
+		store:    store,
+		path:     path,
+		interval: interval,
+	}
+}
+
+func (s *Snapshotter) Start() {
+	go func() {
+		for range time.NewTicker(s.interval).C {
+			if !s.store.IsReady() {
+				continue
+			}
+			err := s.Save()
+			if err != nil {
+				logging.GetLogger().Warnf("could not save store snapshot: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *Snapshotter) Save() error {
+	snapshot := s.store.GetSnapshot()
+	file := &snapshotFile{Time: time.Now().UTC(), Fills: snapshot.Fills}
+	var err error
+	if file.Accounts, err = marshalMessages(snapshot.Accounts); err != nil {
+		return err
+	}
+	if file.Assets, err = marshalMessages(snapshot.Assets); err != nil {
+		return err
+	}
+	if file.Positions, err = marshalMessages(snapshot.Positions); err != nil {
+		return err
+	}
+	if file.Orders, err = marshalMessages(snapshot.Orders); err != nil {
+		return err
+	}
+	if file.MarketData, err = marshalMessages(snapshot.MarketData); err != nil {
+		return err
+	}
+	if file.Markets, err = marshalMessages(snapshot.Markets); err != nil {
+		return err
+	}
+	if file.LiquidityProvisions, err = marshalMessages(snapshot.LiquidityProvisions); err != nil {
+		return err
+	}
+	if file.NetworkParameters, err = marshalMessages(snapshot.NetworkParameters); err != nil {
+		return err
+	}
+	if file.LedgerEntries, err = marshalMessages(snapshot.LedgerEntries); err != nil {
+		return err
+	}
+	if file.Epochs, err = marshalMessages(snapshot.Epochs); err != nil {
+		return err
+	}
+	if file.Rewards, err = marshalMessages(snapshot.Rewards); err != nil {
+		return err
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so that a crash mid-write never leaves a truncated snapshot behind
+	tmpPath := s.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// Load reads the snapshot from disk into the store, returning false if there is no snapshot to load
+func (s *Snapshotter) Load() (bool, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	file := &snapshotFile{}
+	err = json.Unmarshal(data, file)
+	if err != nil {
+		return false, fmt.Errorf("cannot decode snapshot: %v", err)
+	}
+	snapshot := &store.Snapshot{Fills: file.Fills}
+	if snapshot.Accounts, err = unmarshalMessages(file.Accounts, func() *apipb.AccountBalance {
+		return &apipb.AccountBalance{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.Assets, err = unmarshalMessages(file.Assets, func() *vegapb.Asset {
+		return &vegapb.Asset{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.Positions, err = unmarshalMessages(file.Positions, func() *vegapb.Position {
+		return &vegapb.Position{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.Orders, err = unmarshalMessages(file.Orders, func() *vegapb.Order {
+		return &vegapb.Order{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.MarketData, err = unmarshalMessages(file.MarketData, func() *vegapb.MarketData {
+		return &vegapb.MarketData{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.Markets, err = unmarshalMessages(file.Markets, func() *vegapb.Market {
+		return &vegapb.Market{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.LiquidityProvisions, err = unmarshalMessages(file.LiquidityProvisions, func() *vegapb.LiquidityProvision {
+		return &vegapb.LiquidityProvision{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.NetworkParameters, err = unmarshalMessages(file.NetworkParameters, func() *vegapb.NetworkParameter {
+		return &vegapb.NetworkParameter{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.LedgerEntries, err = unmarshalMessages(file.LedgerEntries, func() *apipb.AggregatedLedgerEntry {
+		return &apipb.AggregatedLedgerEntry{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.Epochs, err = unmarshalMessages(file.Epochs, func() *vegapb.Epoch {
+		return &vegapb.Epoch{}
+	}); err != nil {
+		return false, err
+	}
+	if snapshot.Rewards, err = unmarshalMessages(file.Rewards, func() *vegapb.Reward {
+		return &vegapb.Reward{}
+	}); err != nil {
+		return false, err
+	}
+	s.store.LoadSnapshot(snapshot)
+	logging.GetLogger().Infof("loaded store snapshot taken at %s", file.Time)
+	return true, nil
+}
+
+func marshalMessages[T proto.Message](messages []T) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, 0, len(messages))
+	for _, message := range messages {
+		data, err := protojson.Marshal(message)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode snapshot: %v", err)
+		}
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+func unmarshalMessages[T proto.Message](raw []json.RawMessage, newMessage func() T) ([]T, error) {
+	result := make([]T, 0, len(raw))
+	for _, data := range raw {
+		message := newMessage()
+		err := protojson.Unmarshal(data, message)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode snapshot: %v", err)
+		}
+		result = append(result, message)
+	}
+	return result, nil
+}
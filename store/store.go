@@ -3,12 +3,19 @@ package store
 import (
 	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
 	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	eventspb "code.vegaprotocol.io/vega/protos/vega/events/v1"
 	"fmt"
 	"github.com/sasha-s/go-deadlock"
 	"github.com/shopspring/decimal"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"sort"
+	"time"
 )
 
+// MidPriceHistory is how far back mid prices from the market data stream are kept for pricing fills
+const MidPriceHistory = time.Minute * 10
+
 type PriceSource string
 
 const (
@@ -17,25 +24,198 @@ const (
 	Chainlink PriceSource = "Chainlink"
 )
 
+// KeyPair identifies a key the market maker trades with. Private key material stays inside the signer that owns it.
 type KeyPair struct {
-	PrivateKey string
-	PublicKey  string
+	PublicKey string
 }
 
-func NewKeyPair(privateKey string, publicKey string) *KeyPair {
-	return &KeyPair{PrivateKey: privateKey, PublicKey: publicKey}
+func NewKeyPair(publicKey string) *KeyPair {
+	return &KeyPair{PublicKey: publicKey}
 }
 
 type MarketConfig struct {
-	VegaId        string          `json:"vegaId"`
-	ExternalId    string          `json:"externalId"`
-	PriceSource   PriceSource     `json:"priceSource"`
-	Spread        float64         `json:"spread"`
-	ExposureLimit float64         `json:"exposureLimit"`
-	LpRatio       float64         `json:"lpRatio"`
-	KeyPair       *KeyPair        `json:"-"`
-	BidPrice      decimal.Decimal `json:"-"`
-	AskPrice      decimal.Decimal `json:"-"`
+	VegaId        string          `json:"vegaId" yaml:"vegaId"`
+	ExternalId    string          `json:"externalId" yaml:"externalId"`
+	PriceSource   PriceSource     `json:"priceSource" yaml:"priceSource"`
+	Spread        float64         `json:"spread" yaml:"spread"`
+	ExposureLimit float64         `json:"exposureLimit" yaml:"exposureLimit"`
+	LpRatio       float64         `json:"lpRatio" yaml:"lpRatio"`
+	KeyIndex      *uint           `json:"keyIndex" yaml:"keyIndex"`
+	KeyPair       *KeyPair        `json:"-" yaml:"-"`
+	BidPrice      decimal.Decimal `json:"-" yaml:"-"`
+	AskPrice      decimal.Decimal `json:"-" yaml:"-"`
+}
+
+type Fill struct {
+	TradeId           string          `json:"tradeId"`
+	OrderId           string          `json:"orderId"`
+	MarketId          string          `json:"marketId"`
+	PartyId           string          `json:"partyId"`
+	Side              vegapb.Side     `json:"side"`
+	Price             decimal.Decimal `json:"price"`
+	Size              uint64          `json:"size"`
+	Aggressor         bool            `json:"aggressor"`
+	MakerFee          decimal.Decimal `json:"makerFee"`
+	InfrastructureFee decimal.Decimal `json:"infrastructureFee"`
+	LiquidityFee      decimal.Decimal `json:"liquidityFee"`
+	MakerFeeReceived  decimal.Decimal `json:"makerFeeReceived"`
+	MidPrice          decimal.Decimal `json:"midPrice"`
+	Timestamp         int64           `json:"timestamp"`
+}
+
+// NewFills builds the party's side of a trade, or both sides when the party traded with itself
+func NewFills(trade *vegapb.Trade, partyId string, midPrice decimal.Decimal) []*Fill {
+	fills := make([]*Fill, 0, 2)
+	if trade.Buyer == partyId {
+		fills = append(fills, NewFill(trade, partyId, vegapb.Side_SIDE_BUY, midPrice))
+	}
+	if trade.Seller == partyId {
+		fills = append(fills, NewFill(trade, partyId, vegapb.Side_SIDE_SELL, midPrice))
+	}
+	return fills
+}
+
+// NewFill builds one side of a trade for the given party. Fees paid are taken from that side of the
+// trade, and when it was the passive side the maker fee paid by the aggressor is recorded as received.
+// Price and fees are kept in the raw market and asset units reported by Vega. The mid price should be
+// the market mid at the time of the trade, or zero if it is not known.
+func NewFill(trade *vegapb.Trade, partyId string, side vegapb.Side, midPrice decimal.Decimal) *Fill {
+	orderId := trade.BuyOrder
+	fee := trade.BuyerFee
+	counterpartyFee := trade.SellerFee
+	if side == vegapb.Side_SIDE_SELL {
+		orderId = trade.SellOrder
+		fee = trade.SellerFee
+		counterpartyFee = trade.BuyerFee
+	}
+	fill := &Fill{
+		TradeId:           trade.Id,
+		OrderId:           orderId,
+		MarketId:          trade.MarketId,
+		PartyId:           partyId,
+		Side:              side,
+		Price:             ParseDecimal(trade.Price),
+		Size:              trade.Size,
+		Aggressor:         trade.Aggressor == side,
+		MakerFee:          decimal.Zero,
+		InfrastructureFee: decimal.Zero,
+		LiquidityFee:      decimal.Zero,
+		MakerFeeReceived:  decimal.Zero,
+		MidPrice:          midPrice,
+		Timestamp:         trade.Timestamp,
+	}
+	if fee != nil {
+		fill.MakerFee = ParseDecimal(fee.MakerFee)
+		fill.InfrastructureFee = ParseDecimal(fee.InfrastructureFee)
+		fill.LiquidityFee = ParseDecimal(fee.LiquidityFee)
+	}
+	if !fill.Aggressor && counterpartyFee != nil {
+		fill.MakerFeeReceived = ParseDecimal(counterpartyFee.MakerFee)
+	}
+	return fill
+}
+
+// ParseDecimal parses a decimal string reported by Vega, returning zero if it is empty or invalid
+func ParseDecimal(value string) decimal.Decimal {
+	if len(value) == 0 {
+		return decimal.Zero
+	}
+	result, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero
+	}
+	return result
+}
+
+// ToAssetUnits converts an amount in the asset's smallest unit into whole asset units. The amount is returned
+// unchanged if the asset is not known.
+func (s *Store) ToAssetUnits(assetId string, value string) decimal.Decimal {
+	return s.DecimalToAssetUnits(assetId, ParseDecimal(value))
+}
+
+// DecimalToAssetUnits is ToAssetUnits for an amount that has already been parsed
+func (s *Store) DecimalToAssetUnits(assetId string, amount decimal.Decimal) decimal.Decimal {
+	asset := s.GetAsset(assetId)
+	if asset == nil {
+		return amount
+	}
+	return amount.Div(decimal.New(1, int32(asset.Details.Decimals)))
+}
+
+// MarketReadiness records which startup gates a market has passed. Quoting only starts once all of them pass.
+type MarketReadiness struct {
+	MarketId      string `json:"marketId"`
+	ConfigLoaded  bool   `json:"configLoaded"`
+	StoreSynced   bool   `json:"storeSynced"`
+	MarketActive  bool   `json:"marketActive"`
+	BalancesKnown bool   `json:"balancesKnown"`
+	PowAvailable  bool   `json:"powAvailable"`
+	StreamsUp     bool   `json:"streamsUp"`
+	KeyUsable     bool   `json:"keyUsable"`
+	Ready         bool   `json:"ready"`
+}
+
+func (r *MarketReadiness) IsReady() bool {
+	return r.ConfigLoaded && r.StoreSynced && r.MarketActive && r.BalancesKnown && r.PowAvailable && r.StreamsUp &&
+		r.KeyUsable
+}
+
+// KeyPause stops a key's markets from quoting until the given time, in nanoseconds, because Vega would reject its
+// transactions, for example while it is banned for spam or short of margin
+type KeyPause struct {
+	PartyId string `json:"partyId"`
+	Reason  string `json:"reason"`
+	Until   int64  `json:"until"`
+}
+
+// MidPrice is a market mid price sample. The timestamp is in nanoseconds, as reported by Vega.
+type MidPrice struct {
+	Timestamp int64
+	Price     decimal.Decimal
+}
+
+// PowStats describes the proof of work pool. TxByKey counts transactions per key against blocks still in use.
+type PowStats struct {
+	BlockHeight       uint64          `json:"blockHeight"`
+	Depth             int             `json:"depth"`
+	TargetDepth       int             `json:"targetDepth"`
+	TxPerBlock        float64         `json:"txPerBlock"`
+	KeyCount          int             `json:"keyCount"`
+	DepthByDifficulty map[uint]int    `json:"depthByDifficulty"`
+	TxByKey           map[string]uint `json:"txByKey"`
+}
+
+// TxRecord is the outcome of a transaction, after any retries. Failure is empty when it succeeded.
+type TxRecord struct {
+	TxHash      string `json:"txHash"`
+	CommandType string `json:"commandType"`
+	MarketId    string `json:"marketId"`
+	PartyId     string `json:"partyId"`
+	Attempts    int    `json:"attempts"`
+	Success     bool   `json:"success"`
+	Code        uint32 `json:"code"`
+	Data        string `json:"data"`
+	Failure     string `json:"failure,omitempty"`
+	SubmittedAt int64  `json:"submittedAt"`
+}
+
+// MaxTxRecords is how many of the most recent transactions the store keeps
+const MaxTxRecords = 1000
+
+// Snapshot is a point in time copy of the Vega state held by the store, used to warm start after a restart
+type Snapshot struct {
+	Accounts            []*apipb.AccountBalance
+	Assets              []*vegapb.Asset
+	Positions           []*vegapb.Position
+	Orders              []*vegapb.Order
+	MarketData          []*vegapb.MarketData
+	Markets             []*vegapb.Market
+	LiquidityProvisions []*vegapb.LiquidityProvision
+	NetworkParameters   []*vegapb.NetworkParameter
+	Fills               []*Fill
+	LedgerEntries       []*apipb.AggregatedLedgerEntry
+	Epochs              []*vegapb.Epoch
+	Rewards             []*vegapb.Reward
 }
 
 type Store struct {
@@ -45,18 +225,46 @@ type Store struct {
 	positions               map[string]*vegapb.Position
 	orders                  map[string]*vegapb.Order
 	marketData              map[string]*vegapb.MarketData
+	midPrices               map[string][]*MidPrice
 	markets                 map[string]*vegapb.Market
 	liquidityProvisions     map[string]*vegapb.LiquidityProvision
 	networkParameters       map[string]*vegapb.NetworkParameter
+	marketHealth            map[string]bool
+	fills                   map[string]*Fill
+	ledgerEntries           map[string]*apipb.AggregatedLedgerEntry
+	epochs                  map[uint64]*vegapb.Epoch
+	rewards                 map[string]*vegapb.Reward
+	deposits                map[string]*vegapb.Deposit
+	withdrawals             map[string]*vegapb.Withdrawal
+	transfers               map[string]*eventspb.Transfer
+	keyPauses               map[string]*KeyPause
+	ready                   bool
+	marketReadiness         map[string]*MarketReadiness
+	powStats                *PowStats
+	txRecords               []*TxRecord
 	accountsLock            deadlock.RWMutex
 	marketConfigLock        deadlock.RWMutex
 	assetsLock              deadlock.RWMutex
 	positionsLock           deadlock.RWMutex
 	ordersLock              deadlock.RWMutex
 	marketDataLock          deadlock.RWMutex
+	midPricesLock           deadlock.RWMutex
 	marketsLock             deadlock.RWMutex
 	liquidityProvisionsLock deadlock.RWMutex
 	networkParametersLock   deadlock.RWMutex
+	marketHealthLock        deadlock.RWMutex
+	fillsLock               deadlock.RWMutex
+	ledgerEntriesLock       deadlock.RWMutex
+	epochsLock              deadlock.RWMutex
+	rewardsLock             deadlock.RWMutex
+	depositsLock            deadlock.RWMutex
+	withdrawalsLock         deadlock.RWMutex
+	transfersLock           deadlock.RWMutex
+	keyPausesLock           deadlock.RWMutex
+	readyLock               deadlock.RWMutex
+	marketReadinessLock     deadlock.RWMutex
+	powStatsLock            deadlock.RWMutex
+	txRecordsLock           deadlock.RWMutex
 }
 
 func NewStore() *Store {
@@ -67,9 +275,20 @@ func NewStore() *Store {
 		positions:           map[string]*vegapb.Position{},
 		orders:              map[string]*vegapb.Order{},
 		marketData:          map[string]*vegapb.MarketData{},
+		midPrices:           map[string][]*MidPrice{},
 		markets:             map[string]*vegapb.Market{},
 		liquidityProvisions: map[string]*vegapb.LiquidityProvision{},
 		networkParameters:   map[string]*vegapb.NetworkParameter{},
+		marketHealth:        map[string]bool{},
+		fills:               map[string]*Fill{},
+		ledgerEntries:       map[string]*apipb.AggregatedLedgerEntry{},
+		epochs:              map[uint64]*vegapb.Epoch{},
+		rewards:             map[string]*vegapb.Reward{},
+		deposits:            map[string]*vegapb.Deposit{},
+		withdrawals:         map[string]*vegapb.Withdrawal{},
+		transfers:           map[string]*eventspb.Transfer{},
+		keyPauses:           map[string]*KeyPause{},
+		marketReadiness:     map[string]*MarketReadiness{},
 	}
 }
 
@@ -79,10 +298,72 @@ func (s *Store) SaveMarketConfig(market *MarketConfig) {
 	s.marketConfig[market.VegaId] = market
 }
 
+func (s *Store) RemoveMarketConfig(vegaId string) {
+	s.marketConfigLock.Lock()
+	delete(s.marketConfig, vegaId)
+	s.marketConfigLock.Unlock()
+	s.marketHealthLock.Lock()
+	delete(s.marketHealth, vegaId)
+	s.marketHealthLock.Unlock()
+	s.marketReadinessLock.Lock()
+	delete(s.marketReadiness, vegaId)
+	s.marketReadinessLock.Unlock()
+}
+
+// UpdateMarketConfig replaces the config of a market that is already loaded, keeping its reference prices. The
+// prices are carried over under the same lock SaveReferencePrice takes, so that an update made while the config
+// was being reloaded is not lost.
+func (s *Store) UpdateMarketConfig(market *MarketConfig) {
+	s.marketConfigLock.Lock()
+	defer s.marketConfigLock.Unlock()
+	if existing := s.marketConfig[market.VegaId]; existing != nil {
+		market.BidPrice = existing.BidPrice
+		market.AskPrice = existing.AskPrice
+	}
+	s.marketConfig[market.VegaId] = market
+}
+
+// SaveReferencePrice replaces the market config with a copy carrying the new prices, so that readers holding
+// the previous config never see a partial update. Nothing is saved if the market has been removed.
+func (s *Store) SaveReferencePrice(vegaId string, bidPrice decimal.Decimal, askPrice decimal.Decimal) {
+	s.marketConfigLock.Lock()
+	defer s.marketConfigLock.Unlock()
+	existing := s.marketConfig[vegaId]
+	if existing == nil {
+		return
+	}
+	updated := *existing
+	updated.BidPrice = bidPrice
+	updated.AskPrice = askPrice
+	s.marketConfig[vegaId] = &updated
+}
+
 func (s *Store) SaveMarketData(marketData *vegapb.MarketData) {
-	s.marketsLock.Lock()
+	s.marketDataLock.Lock()
 	defer s.marketDataLock.Unlock()
 	s.marketData[marketData.Market] = marketData
+	s.saveMidPrice(marketData)
+}
+
+// saveMidPrice appends the mid price to the market's history and drops samples older than MidPriceHistory.
+// Samples that do not move time forward are ignored so that the history stays sorted.
+func (s *Store) saveMidPrice(marketData *vegapb.MarketData) {
+	midPrice := ParseDecimal(marketData.MidPrice)
+	if midPrice.IsZero() {
+		return
+	}
+	s.midPricesLock.Lock()
+	defer s.midPricesLock.Unlock()
+	history := s.midPrices[marketData.Market]
+	if len(history) > 0 && history[len(history)-1].Timestamp >= marketData.Timestamp {
+		return
+	}
+	history = append(history, &MidPrice{Timestamp: marketData.Timestamp, Price: midPrice})
+	cutoff := marketData.Timestamp - MidPriceHistory.Nanoseconds()
+	first := sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp >= cutoff
+	})
+	s.midPrices[marketData.Market] = history[first:]
 }
 
 func (s *Store) SaveMarket(market *vegapb.Market) {
@@ -131,12 +412,520 @@ func (s *Store) SaveNetworkParameter(networkParameter *vegapb.NetworkParameter)
 	s.networkParameters[networkParameter.Key] = networkParameter
 }
 
+func (s *Store) SaveFill(fill *Fill) {
+	s.fillsLock.Lock()
+	defer s.fillsLock.Unlock()
+	s.fills[getFillId(fill.TradeId, fill.PartyId, fill.Side)] = fill
+}
+
+func (s *Store) GetFill(tradeId string, partyId string, side vegapb.Side) *Fill {
+	s.fillsLock.RLock()
+	defer s.fillsLock.RUnlock()
+	return s.fills[getFillId(tradeId, partyId, side)]
+}
+
+// getFillId includes the side so that both sides of a self-trade are kept
+func getFillId(tradeId string, partyId string, side vegapb.Side) string {
+	return fmt.Sprintf("%s%s%d", tradeId, partyId, side)
+}
+
+func (s *Store) GetFills(marketId string, partyId string) []*Fill {
+	s.fillsLock.RLock()
+	defer s.fillsLock.RUnlock()
+	fills := make([]*Fill, 0)
+	for _, fill := range s.fills {
+		if fill.MarketId == marketId && fill.PartyId == partyId {
+			fills = append(fills, fill)
+		}
+	}
+	sort.Slice(fills, func(i, j int) bool {
+		return fills[i].Timestamp < fills[j].Timestamp
+	})
+	return fills
+}
+
+func (s *Store) SaveLedgerEntry(entry *apipb.AggregatedLedgerEntry) {
+	s.ledgerEntriesLock.Lock()
+	defer s.ledgerEntriesLock.Unlock()
+	// aggregated ledger entries have no id, so they are keyed on everything that identifies the movement
+	id := fmt.Sprintf("%d%s%s%s%s%s%s%s", entry.Timestamp, entry.TransferType, entry.GetAssetId(),
+		entry.GetFromAccountPartyId(), entry.GetFromAccountMarketId(), entry.GetToAccountPartyId(),
+		entry.GetToAccountMarketId(), entry.Quantity)
+	s.ledgerEntries[id] = entry
+}
+
+func (s *Store) GetLedgerEntries(transferType vegapb.TransferType) []*apipb.AggregatedLedgerEntry {
+	s.ledgerEntriesLock.RLock()
+	defer s.ledgerEntriesLock.RUnlock()
+	entries := make([]*apipb.AggregatedLedgerEntry, 0)
+	for _, entry := range s.ledgerEntries {
+		if entry.TransferType == transferType {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+	return entries
+}
+
+func (s *Store) SaveReward(reward *vegapb.Reward) {
+	s.rewardsLock.Lock()
+	defer s.rewardsLock.Unlock()
+	// a party receives at most one reward of each type per asset and market in an epoch
+	id := fmt.Sprintf("%d%s%s%s%s", reward.Epoch, reward.PartyId, reward.AssetId, reward.MarketId, reward.RewardType)
+	s.rewards[id] = reward
+}
+
+// GetRewards returns the rewards paid to the party, oldest epoch first
+func (s *Store) GetRewards(partyId string) []*vegapb.Reward {
+	s.rewardsLock.RLock()
+	defer s.rewardsLock.RUnlock()
+	rewards := make([]*vegapb.Reward, 0)
+	for _, reward := range s.rewards {
+		if reward.PartyId == partyId {
+			rewards = append(rewards, reward)
+		}
+	}
+	sort.Slice(rewards, func(i, j int) bool {
+		return rewards[i].Epoch < rewards[j].Epoch
+	})
+	return rewards
+}
+
+func (s *Store) SaveEpoch(epoch *vegapb.Epoch) {
+	s.epochsLock.Lock()
+	defer s.epochsLock.Unlock()
+	s.epochs[epoch.Seq] = epoch
+}
+
+func (s *Store) GetEpoch(seq uint64) *vegapb.Epoch {
+	s.epochsLock.RLock()
+	defer s.epochsLock.RUnlock()
+	return s.epochs[seq]
+}
+
+func (s *Store) GetEpochs() []*vegapb.Epoch {
+	s.epochsLock.RLock()
+	defer s.epochsLock.RUnlock()
+	epochs := maps.Values(s.epochs)
+	sort.Slice(epochs, func(i, j int) bool {
+		return epochs[i].Seq < epochs[j].Seq
+	})
+	return epochs
+}
+
+func (s *Store) SaveDeposit(deposit *vegapb.Deposit) {
+	s.depositsLock.Lock()
+	defer s.depositsLock.Unlock()
+	s.deposits[deposit.Id] = deposit
+}
+
+func (s *Store) GetDeposits(partyId string) []*vegapb.Deposit {
+	s.depositsLock.RLock()
+	defer s.depositsLock.RUnlock()
+	deposits := make([]*vegapb.Deposit, 0)
+	for _, deposit := range s.deposits {
+		if deposit.PartyId == partyId {
+			deposits = append(deposits, deposit)
+		}
+	}
+	sort.Slice(deposits, func(i, j int) bool {
+		return deposits[i].CreatedTimestamp < deposits[j].CreatedTimestamp
+	})
+	return deposits
+}
+
+func (s *Store) SaveWithdrawal(withdrawal *vegapb.Withdrawal) {
+	s.withdrawalsLock.Lock()
+	defer s.withdrawalsLock.Unlock()
+	s.withdrawals[withdrawal.Id] = withdrawal
+}
+
+func (s *Store) GetWithdrawals(partyId string) []*vegapb.Withdrawal {
+	s.withdrawalsLock.RLock()
+	defer s.withdrawalsLock.RUnlock()
+	withdrawals := make([]*vegapb.Withdrawal, 0)
+	for _, withdrawal := range s.withdrawals {
+		if withdrawal.PartyId == partyId {
+			withdrawals = append(withdrawals, withdrawal)
+		}
+	}
+	sort.Slice(withdrawals, func(i, j int) bool {
+		return withdrawals[i].CreatedTimestamp < withdrawals[j].CreatedTimestamp
+	})
+	return withdrawals
+}
+
+func (s *Store) SaveTransfer(transfer *eventspb.Transfer) {
+	s.transfersLock.Lock()
+	defer s.transfersLock.Unlock()
+	s.transfers[transfer.Id] = transfer
+}
+
+// GetTransfers returns the transfers to or from the party
+func (s *Store) GetTransfers(partyId string) []*eventspb.Transfer {
+	s.transfersLock.RLock()
+	defer s.transfersLock.RUnlock()
+	transfers := make([]*eventspb.Transfer, 0)
+	for _, transfer := range s.transfers {
+		if transfer.From == partyId || transfer.To == partyId {
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].Timestamp < transfers[j].Timestamp
+	})
+	return transfers
+}
+
+// PauseKey keeps the longer of the new and any existing pause
+func (s *Store) PauseKey(pause *KeyPause) {
+	s.keyPausesLock.Lock()
+	defer s.keyPausesLock.Unlock()
+	existing := s.keyPauses[pause.PartyId]
+	if existing == nil || existing.Until < pause.Until {
+		s.keyPauses[pause.PartyId] = pause
+	}
+}
+
+// GetKeyPause returns the key's pause, or nil if it is not paused
+func (s *Store) GetKeyPause(partyId string) *KeyPause {
+	s.keyPausesLock.Lock()
+	defer s.keyPausesLock.Unlock()
+	pause := s.keyPauses[partyId]
+	if pause != nil && pause.Until <= time.Now().UnixNano() {
+		delete(s.keyPauses, partyId)
+		return nil
+	}
+	return pause
+}
+
+func (s *Store) SetReady(ready bool) {
+	s.readyLock.Lock()
+	defer s.readyLock.Unlock()
+	s.ready = ready
+}
+
+func (s *Store) IsReady() bool {
+	s.readyLock.RLock()
+	defer s.readyLock.RUnlock()
+	return s.ready
+}
+
+func (s *Store) SaveMarketReadiness(readiness *MarketReadiness) {
+	s.marketReadinessLock.Lock()
+	defer s.marketReadinessLock.Unlock()
+	readiness.Ready = readiness.IsReady()
+	s.marketReadiness[readiness.MarketId] = readiness
+}
+
+func (s *Store) IsMarketReady(marketId string) bool {
+	s.marketReadinessLock.RLock()
+	defer s.marketReadinessLock.RUnlock()
+	readiness := s.marketReadiness[marketId]
+	return readiness != nil && readiness.IsReady()
+}
+
+func (s *Store) GetMarketReadiness() []*MarketReadiness {
+	s.marketReadinessLock.RLock()
+	defer s.marketReadinessLock.RUnlock()
+	result := make([]*MarketReadiness, 0, len(s.marketReadiness))
+	for _, readiness := range s.marketReadiness {
+		copied := *readiness
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].MarketId < result[j].MarketId
+	})
+	return result
+}
+
+func (s *Store) SavePowStats(stats *PowStats) {
+	s.powStatsLock.Lock()
+	defer s.powStatsLock.Unlock()
+	s.powStats = stats
+}
+
+func (s *Store) GetPowStats() *PowStats {
+	s.powStatsLock.RLock()
+	defer s.powStatsLock.RUnlock()
+	if s.powStats == nil {
+		return &PowStats{DepthByDifficulty: map[uint]int{}, TxByKey: map[string]uint{}}
+	}
+	return s.powStats
+}
+
+func (s *Store) SaveTxRecord(record *TxRecord) {
+	s.txRecordsLock.Lock()
+	defer s.txRecordsLock.Unlock()
+	s.txRecords = append(s.txRecords, record)
+	if len(s.txRecords) > MaxTxRecords {
+		s.txRecords = s.txRecords[len(s.txRecords)-MaxTxRecords:]
+	}
+}
+
+// GetTxRecords lists the most recent transactions, oldest first
+func (s *Store) GetTxRecords() []*TxRecord {
+	s.txRecordsLock.RLock()
+	defer s.txRecordsLock.RUnlock()
+	result := make([]*TxRecord, 0, len(s.txRecords))
+	for _, record := range s.txRecords {
+		copied := *record
+		result = append(result, &copied)
+	}
+	return result
+}
+
+func (s *Store) GetSnapshot() *Snapshot {
+	snapshot := &Snapshot{}
+	s.accountsLock.RLock()
+	snapshot.Accounts = maps.Values(s.accounts)
+	s.accountsLock.RUnlock()
+	s.assetsLock.RLock()
+	snapshot.Assets = maps.Values(s.assets)
+	s.assetsLock.RUnlock()
+	s.positionsLock.RLock()
+	snapshot.Positions = maps.Values(s.positions)
+	s.positionsLock.RUnlock()
+	s.ordersLock.RLock()
+	snapshot.Orders = maps.Values(s.orders)
+	s.ordersLock.RUnlock()
+	s.marketDataLock.RLock()
+	snapshot.MarketData = maps.Values(s.marketData)
+	s.marketDataLock.RUnlock()
+	s.marketsLock.RLock()
+	snapshot.Markets = maps.Values(s.markets)
+	s.marketsLock.RUnlock()
+	s.liquidityProvisionsLock.RLock()
+	snapshot.LiquidityProvisions = maps.Values(s.liquidityProvisions)
+	s.liquidityProvisionsLock.RUnlock()
+	s.networkParametersLock.RLock()
+	snapshot.NetworkParameters = maps.Values(s.networkParameters)
+	s.networkParametersLock.RUnlock()
+	s.fillsLock.RLock()
+	snapshot.Fills = maps.Values(s.fills)
+	s.fillsLock.RUnlock()
+	s.ledgerEntriesLock.RLock()
+	snapshot.LedgerEntries = maps.Values(s.ledgerEntries)
+	s.ledgerEntriesLock.RUnlock()
+	s.epochsLock.RLock()
+	snapshot.Epochs = maps.Values(s.epochs)
+	s.epochsLock.RUnlock()
+	s.rewardsLock.RLock()
+	snapshot.Rewards = maps.Values(s.rewards)
+	s.rewardsLock.RUnlock()
+	return snapshot
+}
+
+func (s *Store) LoadSnapshot(snapshot *Snapshot) {
+	for _, account := range snapshot.Accounts {
+		s.SaveAccount(account)
+	}
+	for _, asset := range snapshot.Assets {
+		s.SaveAsset(asset)
+	}
+	for _, position := range snapshot.Positions {
+		s.SavePosition(position)
+	}
+	for _, order := range snapshot.Orders {
+		s.SaveOrder(order)
+	}
+	for _, data := range snapshot.MarketData {
+		s.SaveMarketData(data)
+	}
+	for _, market := range snapshot.Markets {
+		s.SaveMarket(market)
+	}
+	for _, lp := range snapshot.LiquidityProvisions {
+		s.SaveLiquidityProvision(lp)
+	}
+	for _, param := range snapshot.NetworkParameters {
+		s.SaveNetworkParameter(param)
+	}
+	for _, fill := range snapshot.Fills {
+		s.SaveFill(fill)
+	}
+	for _, entry := range snapshot.LedgerEntries {
+		s.SaveLedgerEntry(entry)
+	}
+	for _, epoch := range snapshot.Epochs {
+		s.SaveEpoch(epoch)
+	}
+	for _, reward := range snapshot.Rewards {
+		s.SaveReward(reward)
+	}
+}
+
+// ReconcileOrders removes orders for the given parties that the store believes are live but are missing from
+// a fresh list of live orders, returning the ids of the removed orders
+func (s *Store) ReconcileOrders(partyIds []string, liveOrders []*vegapb.Order) []string {
+	s.ordersLock.Lock()
+	defer s.ordersLock.Unlock()
+	live := map[string]bool{}
+	for _, order := range liveOrders {
+		live[order.Id] = true
+	}
+	removed := make([]string, 0)
+	for id, order := range s.orders {
+		if slices.Contains(partyIds, order.PartyId) && order.Status == vegapb.Order_STATUS_ACTIVE && !live[id] {
+			delete(s.orders, id)
+			removed = append(removed, id)
+		}
+	}
+	return removed
+}
+
+// ReconcilePositions removes positions for the given parties that are missing from a fresh list of positions,
+// returning the ids of the removed positions
+func (s *Store) ReconcilePositions(partyIds []string, positions []*vegapb.Position) []string {
+	s.positionsLock.Lock()
+	defer s.positionsLock.Unlock()
+	current := map[string]bool{}
+	for _, position := range positions {
+		current[fmt.Sprintf("%s%s", position.PartyId, position.MarketId)] = true
+	}
+	removed := make([]string, 0)
+	for id, position := range s.positions {
+		if slices.Contains(partyIds, position.PartyId) && !current[id] {
+			delete(s.positions, id)
+			removed = append(removed, id)
+		}
+	}
+	return removed
+}
+
+// ReconcileAccounts removes accounts owned by the given parties that are missing from a fresh list of accounts,
+// returning the ids of the removed accounts
+func (s *Store) ReconcileAccounts(partyIds []string, accounts []*apipb.AccountBalance) []string {
+	s.accountsLock.Lock()
+	defer s.accountsLock.Unlock()
+	current := map[string]bool{}
+	for _, account := range accounts {
+		current[fmt.Sprintf("%s%s%s%s", account.Asset, account.Owner, account.Type, account.MarketId)] = true
+	}
+	removed := make([]string, 0)
+	for id, account := range s.accounts {
+		if slices.Contains(partyIds, account.Owner) && !current[id] {
+			delete(s.accounts, id)
+			removed = append(removed, id)
+		}
+	}
+	return removed
+}
+
+func (s *Store) SaveMarketHealth(marketId string, healthy bool) {
+	s.marketHealthLock.Lock()
+	defer s.marketHealthLock.Unlock()
+	s.marketHealth[marketId] = healthy
+}
+
+func (s *Store) IsMarketHealthy(marketId string) bool {
+	s.marketHealthLock.RLock()
+	defer s.marketHealthLock.RUnlock()
+	return s.marketHealth[marketId]
+}
+
 func (s *Store) GetMarketConfig() []*MarketConfig {
 	s.marketConfigLock.RLock()
 	defer s.marketConfigLock.RUnlock()
 	return maps.Values(s.marketConfig)
 }
 
+func (s *Store) GetAccounts(marketId string, accountType vegapb.AccountType) []*apipb.AccountBalance {
+	s.accountsLock.RLock()
+	defer s.accountsLock.RUnlock()
+	accounts := make([]*apipb.AccountBalance, 0)
+	for _, account := range s.accounts {
+		if account.MarketId == marketId && account.Type == accountType {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+func (s *Store) GetPartyAccounts(partyId string) []*apipb.AccountBalance {
+	s.accountsLock.RLock()
+	defer s.accountsLock.RUnlock()
+	accounts := make([]*apipb.AccountBalance, 0)
+	for _, account := range s.accounts {
+		if account.Owner == partyId {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+func (s *Store) GetMarket(marketId string) *vegapb.Market {
+	s.marketsLock.RLock()
+	defer s.marketsLock.RUnlock()
+	return s.markets[marketId]
+}
+
+func (s *Store) GetAsset(assetId string) *vegapb.Asset {
+	s.assetsLock.RLock()
+	defer s.assetsLock.RUnlock()
+	return s.assets[assetId]
+}
+
+func (s *Store) GetMarketData(marketId string) *vegapb.MarketData {
+	s.marketDataLock.RLock()
+	defer s.marketDataLock.RUnlock()
+	return s.marketData[marketId]
+}
+
+// GetMidPrice returns the last mid price seen at or before the timestamp, in nanoseconds. It returns false
+// when the timestamp is older than the history kept for the market.
+func (s *Store) GetMidPrice(marketId string, timestamp int64) (decimal.Decimal, bool) {
+	s.midPricesLock.RLock()
+	defer s.midPricesLock.RUnlock()
+	history := s.midPrices[marketId]
+	next := sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp > timestamp
+	})
+	if next == 0 {
+		return decimal.Zero, false
+	}
+	return history[next-1].Price, true
+}
+
+func (s *Store) GetPosition(marketId string, partyId string) *vegapb.Position {
+	s.positionsLock.RLock()
+	defer s.positionsLock.RUnlock()
+	id := fmt.Sprintf("%s%s", partyId, marketId)
+	return s.positions[id]
+}
+
+func (s *Store) GetOrder(orderId string) *vegapb.Order {
+	s.ordersLock.RLock()
+	defer s.ordersLock.RUnlock()
+	return s.orders[orderId]
+}
+
+func (s *Store) GetPartyPositions(partyId string) []*vegapb.Position {
+	s.positionsLock.RLock()
+	defer s.positionsLock.RUnlock()
+	positions := make([]*vegapb.Position, 0)
+	for _, position := range s.positions {
+		if position.PartyId == partyId {
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
+
+func (s *Store) GetLiveOrders(marketId string, partyId string) []*vegapb.Order {
+	s.ordersLock.RLock()
+	defer s.ordersLock.RUnlock()
+	orders := make([]*vegapb.Order, 0)
+	for _, order := range s.orders {
+		if order.MarketId == marketId && order.PartyId == partyId && order.Status == vegapb.Order_STATUS_ACTIVE {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
 func (s *Store) GetNetworkParameter(key string) *vegapb.NetworkParameter {
 	s.networkParametersLock.RLock()
 	defer s.networkParametersLock.RUnlock()
@@ -0,0 +1,130 @@
+package store
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+func TestNewFillsSelfTrade(t *testing.T) {
+	trade := &vegapb.Trade{
+		Id:        "trade-1",
+		MarketId:  "market-1",
+		Price:     "100",
+		Size:      2,
+		Buyer:     "party-a",
+		Seller:    "party-a",
+		BuyOrder:  "order-buy",
+		SellOrder: "order-sell",
+		Aggressor: vegapb.Side_SIDE_SELL,
+		BuyerFee:  &vegapb.Fee{MakerFee: "0"},
+		SellerFee: &vegapb.Fee{MakerFee: "3"},
+	}
+	fills := NewFills(trade, "party-a", decimal.Zero)
+	if len(fills) != 2 {
+		t.Fatalf("expected both sides of a self-trade, got %d fills", len(fills))
+	}
+	buy, sell := fills[0], fills[1]
+	if buy.Side != vegapb.Side_SIDE_BUY || buy.OrderId != "order-buy" || buy.Aggressor {
+		t.Fatalf("unexpected buy fill: %+v", buy)
+	}
+	if !buy.MakerFeeReceived.Equal(decimal.NewFromInt(3)) {
+		t.Fatalf("expected the passive side to receive the maker fee, got %s", buy.MakerFeeReceived)
+	}
+	if sell.Side != vegapb.Side_SIDE_SELL || sell.OrderId != "order-sell" || !sell.Aggressor {
+		t.Fatalf("unexpected sell fill: %+v", sell)
+	}
+	s := NewStore()
+	s.SaveFill(buy)
+	if s.GetFill("trade-1", "party-a", vegapb.Side_SIDE_BUY) == nil ||
+		s.GetFill("trade-1", "party-a", vegapb.Side_SIDE_SELL) != nil {
+		t.Fatal("expected fills to be stored per side")
+	}
+	s.SaveFill(sell)
+	if len(s.GetFills("market-1", "party-a")) != 2 {
+		t.Fatal("expected both sides to be kept")
+	}
+}
+
+func TestNewFillsOtherParty(t *testing.T) {
+	trade := &vegapb.Trade{Id: "trade-1", Buyer: "party-a", Seller: "party-b"}
+	if fills := NewFills(trade, "party-c", decimal.Zero); len(fills) != 0 {
+		t.Fatalf("expected no fills for a party that did not trade, got %d", len(fills))
+	}
+	fills := NewFills(trade, "party-b", decimal.Zero)
+	if len(fills) != 1 || fills[0].Side != vegapb.Side_SIDE_SELL {
+		t.Fatalf("expected a single sell fill, got %+v", fills)
+	}
+}
+
+func TestGetMidPriceAtTradeTime(t *testing.T) {
+	s := NewStore()
+	s.SaveMarketData(&vegapb.MarketData{Market: "market-1", MidPrice: "100", Timestamp: 1000})
+	s.SaveMarketData(&vegapb.MarketData{Market: "market-1", MidPrice: "105", Timestamp: 2000})
+	s.SaveMarketData(&vegapb.MarketData{Market: "market-1", MidPrice: "999", Timestamp: 1500})
+	if _, ok := s.GetMidPrice("market-1", 999); ok {
+		t.Fatalf("expected no mid price before the first sample")
+	}
+	for timestamp, expected := range map[int64]string{1000: "100", 1999: "100", 2000: "105", 5000: "105"} {
+		midPrice, ok := s.GetMidPrice("market-1", timestamp)
+		if !ok || !midPrice.Equal(decimal.RequireFromString(expected)) {
+			t.Fatalf("expected mid price %s at %d, got %s", expected, timestamp, midPrice)
+		}
+	}
+}
+
+func TestMidPriceHistoryIsTrimmed(t *testing.T) {
+	s := NewStore()
+	s.SaveMarketData(&vegapb.MarketData{Market: "market-1", MidPrice: "100", Timestamp: 0})
+	s.SaveMarketData(&vegapb.MarketData{
+		Market:    "market-1",
+		MidPrice:  "105",
+		Timestamp: MidPriceHistory.Nanoseconds() + 1,
+	})
+	if _, ok := s.GetMidPrice("market-1", 1); ok {
+		t.Fatalf("expected samples older than the history window to be dropped")
+	}
+}
+
+func TestUpdateMarketConfigKeepsReferencePrices(t *testing.T) {
+	s := NewStore()
+	s.SaveMarketConfig(&MarketConfig{VegaId: "market-1", Spread: 0.1})
+	s.SaveReferencePrice("market-1", decimal.NewFromInt(99), decimal.NewFromInt(101))
+	s.UpdateMarketConfig(&MarketConfig{VegaId: "market-1", Spread: 0.2})
+	updated := s.GetMarketConfig()[0]
+	if updated.Spread != 0.2 {
+		t.Fatalf("expected the reloaded spread, got %v", updated.Spread)
+	}
+	if !updated.BidPrice.Equal(decimal.NewFromInt(99)) || !updated.AskPrice.Equal(decimal.NewFromInt(101)) {
+		t.Fatalf("expected reference prices to be kept, got %s/%s", updated.BidPrice, updated.AskPrice)
+	}
+}
+
+func TestToAssetUnits(t *testing.T) {
+	s := NewStore()
+	s.SaveAsset(&vegapb.Asset{Id: "asset-1", Details: &vegapb.AssetDetails{Decimals: 6}})
+	if amount := s.ToAssetUnits("asset-1", "1500000"); !amount.Equal(decimal.RequireFromString("1.5")) {
+		t.Fatalf("expected 1.5, got %s", amount)
+	}
+	if amount := s.ToAssetUnits("asset-2", "1500000"); !amount.Equal(decimal.NewFromInt(1500000)) {
+		t.Fatalf("expected an unknown asset to be left unchanged, got %s", amount)
+	}
+	if amount := s.ToAssetUnits("asset-1", ""); !amount.IsZero() {
+		t.Fatalf("expected an empty amount to be zero, got %s", amount)
+	}
+}
+
+func TestKeyPauseKeepsTheLongerPause(t *testing.T) {
+	s := NewStore()
+	later := time.Now().Add(time.Hour).UnixNano()
+	s.PauseKey(&KeyPause{PartyId: "party-1", Reason: "spamBan", Until: later})
+	s.PauseKey(&KeyPause{PartyId: "party-1", Reason: "insufficientMargin", Until: time.Now().Add(time.Minute).UnixNano()})
+	if pause := s.GetKeyPause("party-1"); pause == nil || pause.Until != later {
+		t.Fatalf("expected the longer pause to be kept, got %+v", pause)
+	}
+	s.PauseKey(&KeyPause{PartyId: "party-2", Until: time.Now().Add(-time.Second).UnixNano()})
+	if pause := s.GetKeyPause("party-2"); pause != nil {
+		t.Fatalf("expected an expired pause to be ignored, got %+v", pause)
+	}
+}
@@ -0,0 +1,308 @@
+package treasury
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	eventspb "code.vegaprotocol.io/vega/protos/vega/events/v1"
+	"context"
+	"github.com/sasha-s/go-deadlock"
+	"github.com/shopspring/decimal"
+	"time"
+	"vega-cli-mm/config"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/store"
+	"vega-cli-mm/vega"
+)
+
+const TopUpReference = "vega-cli-mm treasury top up"
+const SweepReference = "vega-cli-mm treasury sweep"
+
+const (
+	FeeFactorParameter          = "transfer.fee.factor"
+	MinTransferQuantumParameter = "transfer.minTransferQuantumAmount"
+)
+
+// Treasury keeps the general account of every market key between a minimum and maximum balance per asset. Keys
+// below the minimum are topped up from the funding key to the target, and keys above the maximum have the excess
+// swept back to the funding key, keeping back whatever their positions still need for margin. The total moved per
+// asset, in both directions, is capped per UTC day. The day's total is rebuilt from the funding key's transfers
+// on the data node, so a restart does not reset it.
+type Treasury struct {
+	store           *store.Store
+	vega            *vega.Vega
+	config          config.TreasuryConfig
+	fundingKey      *store.KeyPair
+	transferredLock deadlock.Mutex
+	day             string
+	transferred     map[string]decimal.Decimal
+	reported        map[string]bool
+}
+
+func NewTreasury(
+	store *store.Store,
+	vega *vega.Vega,
+	config config.TreasuryConfig,
+	fundingKey *store.KeyPair,
+) *Treasury {
+	return &Treasury{
+		store:       store,
+		vega:        vega,
+		config:      config,
+		fundingKey:  fundingKey,
+		transferred: map[string]decimal.Decimal{},
+		reported:    map[string]bool{},
+	}
+}
+
+func (t *Treasury) Start() {
+	go func() {
+		for range time.NewTicker(t.config.Interval).C {
+			if !t.store.IsReady() {
+				continue
+			}
+			t.rebalance()
+		}
+	}()
+}
+
+func (t *Treasury) getMarketKeys() []string {
+	seen := map[string]bool{}
+	partyIds := make([]string, 0)
+	for _, marketConfig := range t.store.GetMarketConfig() {
+		partyId := marketConfig.KeyPair.PublicKey
+		if !seen[partyId] && partyId != t.fundingKey.PublicKey {
+			seen[partyId] = true
+			partyIds = append(partyIds, partyId)
+		}
+	}
+	return partyIds
+}
+
+// rebalance fetches fresh balances rather than relying on the account streams, because the funding key is not
+// streamed and a stale balance would cause the same transfer to be sent twice
+func (t *Treasury) rebalance() {
+	err := t.syncTransferred()
+	if err != nil {
+		// without today's total the daily limit cannot be enforced
+		logging.GetLogger().Warnf("treasury could not rebalance: %v", err)
+		return
+	}
+	partyIds := t.getMarketKeys()
+	accounts, err := t.vega.GetAccounts(append(partyIds, t.fundingKey.PublicKey))
+	if err != nil {
+		// every balance would read as zero, which would top up keys that are already funded
+		logging.GetLogger().Warnf("treasury could not rebalance: %v", err)
+		return
+	}
+	balances := map[string]decimal.Decimal{}
+	margins := map[string]decimal.Decimal{}
+	for _, account := range accounts {
+		t.store.SaveAccount(account)
+		switch account.Type {
+		case vegapb.AccountType_ACCOUNT_TYPE_GENERAL:
+			balances[account.Owner+account.Asset] = store.ParseDecimal(account.Balance)
+		case vegapb.AccountType_ACCOUNT_TYPE_MARGIN:
+			margins[account.Owner+account.MarketId] = store.ParseDecimal(account.Balance)
+		}
+	}
+	feeFactor := t.getNetworkParameter(FeeFactorParameter)
+	for _, assetConfig := range t.config.Assets {
+		asset := t.store.GetAsset(assetConfig.AssetId)
+		if asset == nil {
+			logging.GetLogger().Warnf("treasury cannot find asset %s", assetConfig.AssetId)
+			continue
+		}
+		multiplier := decimal.New(1, int32(asset.Details.Decimals))
+		minBalance := decimal.NewFromFloat(assetConfig.MinBalance).Mul(multiplier)
+		targetBalance := decimal.NewFromFloat(assetConfig.TargetBalance).Mul(multiplier)
+		maxBalance := decimal.NewFromFloat(assetConfig.MaxBalance).Mul(multiplier)
+		dailyLimit := decimal.NewFromFloat(assetConfig.DailyLimit).Mul(multiplier)
+		minTransfer := t.getNetworkParameter(MinTransferQuantumParameter).Mul(store.ParseDecimal(asset.Details.Quantum))
+		for _, partyId := range partyIds {
+			balance := balances[partyId+asset.Id]
+			if balance.LessThan(minBalance) {
+				fundingBalance := balances[t.fundingKey.PublicKey+asset.Id]
+				amount := t.getTransferAmount(asset.Id, targetBalance.Sub(balance), fundingBalance, feeFactor,
+					dailyLimit, minTransfer)
+				sent := t.transfer(t.fundingKey.PublicKey, partyId, asset.Id, amount, TopUpReference)
+				balances[t.fundingKey.PublicKey+asset.Id] = fundingBalance.Sub(sent.Mul(decimal.NewFromInt(1).Add(feeFactor)))
+			} else if balance.GreaterThan(maxBalance) {
+				marginNeeded, err := t.getMarginNeeded(partyId, asset.Id, margins)
+				if err != nil {
+					logging.GetLogger().Warnf("treasury cannot sweep %s: %v", partyId, err)
+					continue
+				}
+				excess := balance.Sub(targetBalance).Sub(marginNeeded)
+				amount := t.getTransferAmount(asset.Id, excess, excess, feeFactor, dailyLimit, minTransfer)
+				sent := t.transfer(partyId, t.fundingKey.PublicKey, asset.Id, amount, SweepReference)
+				balances[t.fundingKey.PublicKey+asset.Id] = balances[t.fundingKey.PublicKey+asset.Id].Add(sent)
+			}
+		}
+	}
+}
+
+func (t *Treasury) getNetworkParameter(key string) decimal.Decimal {
+	param := t.store.GetNetworkParameter(key)
+	if param == nil {
+		return decimal.Zero
+	}
+	return store.ParseDecimal(param.Value)
+}
+
+// getMarginNeeded is how much more the party's positions in the asset need to reach their initial margin, which
+// would be taken from the general account
+func (t *Treasury) getMarginNeeded(
+	partyId string,
+	assetId string,
+	margins map[string]decimal.Decimal,
+) (decimal.Decimal, error) {
+	marginLevels, err := t.vega.GetMarginLevels(partyId)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	needed := decimal.Zero
+	for _, levels := range marginLevels {
+		if levels.Asset != assetId {
+			continue
+		}
+		shortfall := store.ParseDecimal(levels.InitialMargin).Sub(margins[partyId+levels.MarketId])
+		needed = needed.Add(decimal.Max(shortfall, decimal.Zero))
+	}
+	return needed, nil
+}
+
+// getTransferAmount limits the wanted amount to what the sender can pay once the transfer fee is added and to
+// what is left of today's limit
+func (t *Treasury) getTransferAmount(
+	assetId string,
+	wanted decimal.Decimal,
+	available decimal.Decimal,
+	feeFactor decimal.Decimal,
+	dailyLimit decimal.Decimal,
+	minTransfer decimal.Decimal,
+) decimal.Decimal {
+	remaining := dailyLimit.Sub(t.getTransferred(assetId))
+	amount := getTransferAmount(wanted, available, feeFactor, remaining, minTransfer)
+	if amount.LessThan(wanted.Truncate(0)) && wanted.GreaterThan(remaining) {
+		logging.GetLogger().Warnf("treasury daily limit reached for asset %s, sending %s of %s",
+			assetId, amount, wanted)
+	}
+	return amount
+}
+
+// getTransferAmount returns the largest whole amount, in asset decimals, that is no more than wanted, leaves the
+// sender enough of available to pay the fee, and fits in what remains of the daily limit. Zero is returned when
+// that is below the network's minimum transfer.
+func getTransferAmount(
+	wanted decimal.Decimal,
+	available decimal.Decimal,
+	feeFactor decimal.Decimal,
+	remaining decimal.Decimal,
+	minTransfer decimal.Decimal,
+) decimal.Decimal {
+	affordable := available.Div(decimal.NewFromInt(1).Add(feeFactor))
+	amount := decimal.Min(wanted, affordable, remaining).Truncate(0)
+	if !amount.IsPositive() || amount.LessThan(minTransfer) {
+		return decimal.Zero
+	}
+	return amount
+}
+
+// transfer sends the amount, if any, and returns the amount sent
+func (t *Treasury) transfer(
+	fromPartyId string,
+	toPartyId string,
+	assetId string,
+	amount decimal.Decimal,
+	reference string,
+) decimal.Decimal {
+	if !amount.IsPositive() {
+		return decimal.Zero
+	}
+	logging.GetLogger().Infof("treasury transferring %s %s from %s to %s", amount, assetId, fromPartyId, toPartyId)
+	err := t.vega.Transfer(context.Background(), fromPartyId, toPartyId, assetId, amount.String(), reference)
+	if err != nil {
+		logging.GetLogger().Warnf("treasury transfer failed: %v", err)
+		return decimal.Zero
+	}
+	t.addTransferred(assetId, amount)
+	return amount
+}
+
+// syncTransferred rebuilds today's totals from the treasury transfers the data node knows about. Transfers sent
+// since then may not have reached the data node yet, so a total is never lowered. Vega only checks that the sender
+// can pay once a transfer is executed, so this is also where rejected transfers are reported.
+func (t *Treasury) syncTransferred() error {
+	transfers, err := t.vega.GetTransfers(t.fundingKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	totals := getTransferredToday(transfers, now)
+	t.transferredLock.Lock()
+	defer t.transferredLock.Unlock()
+	t.resetIfNewDay()
+	for assetId, total := range totals {
+		t.transferred[assetId] = decimal.Max(t.transferred[assetId], total)
+	}
+	for _, transfer := range transfers {
+		if transfer.Status != eventspb.Transfer_STATUS_REJECTED || t.reported[transfer.Id] ||
+			transfer.Timestamp < startOfDay(now) {
+			continue
+		}
+		if transfer.Reference != TopUpReference && transfer.Reference != SweepReference {
+			continue
+		}
+		t.reported[transfer.Id] = true
+		logging.GetLogger().Warnf("treasury transfer %s of %s %s from %s to %s was rejected: %s", transfer.Id,
+			transfer.Amount, transfer.Asset, transfer.From, transfer.To, transfer.GetReason())
+	}
+	return nil
+}
+
+// getTransferredToday totals, per asset, the treasury transfers made since midnight UTC that were not rejected
+// or cancelled
+func getTransferredToday(transfers []*eventspb.Transfer, now time.Time) map[string]decimal.Decimal {
+	midnight := startOfDay(now)
+	totals := map[string]decimal.Decimal{}
+	for _, transfer := range transfers {
+		if transfer.Reference != TopUpReference && transfer.Reference != SweepReference {
+			continue
+		}
+		if transfer.Status == eventspb.Transfer_STATUS_REJECTED ||
+			transfer.Status == eventspb.Transfer_STATUS_CANCELLED || transfer.Timestamp < midnight {
+			continue
+		}
+		totals[transfer.Asset] = totals[transfer.Asset].Add(store.ParseDecimal(transfer.Amount))
+	}
+	return totals
+}
+
+// startOfDay returns midnight UTC on the given day, in nanoseconds
+func startOfDay(now time.Time) int64 {
+	year, month, day := now.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).UnixNano()
+}
+
+func (t *Treasury) getTransferred(assetId string) decimal.Decimal {
+	t.transferredLock.Lock()
+	defer t.transferredLock.Unlock()
+	t.resetIfNewDay()
+	return t.transferred[assetId]
+}
+
+func (t *Treasury) addTransferred(assetId string, amount decimal.Decimal) {
+	t.transferredLock.Lock()
+	defer t.transferredLock.Unlock()
+	t.resetIfNewDay()
+	t.transferred[assetId] = t.transferred[assetId].Add(amount)
+}
+
+// resetIfNewDay must be called with the lock held
+func (t *Treasury) resetIfNewDay() {
+	today := time.Now().UTC().Format("2006-01-02")
+	if t.day != today {
+		t.day = today
+		t.transferred = map[string]decimal.Decimal{}
+		t.reported = map[string]bool{}
+	}
+}
@@ -0,0 +1,66 @@
+package treasury
+
+import (
+	eventspb "code.vegaprotocol.io/vega/protos/vega/events/v1"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+func TestGetTransferAmount(t *testing.T) {
+	for name, tc := range map[string]struct {
+		wanted, available, feeFactor, remaining, minTransfer, expected int64
+	}{
+		"wanted amount":              {wanted: 100, available: 1000, remaining: 1000, expected: 100},
+		"capped at the daily limit":  {wanted: 100, available: 1000, remaining: 60, expected: 60},
+		"daily limit used up":        {wanted: 100, available: 1000, remaining: 0, expected: 0},
+		"daily limit exceeded":       {wanted: 100, available: 1000, remaining: -10, expected: 0},
+		"room left for the fee":      {wanted: 100, available: 100, feeFactor: 1, remaining: 1000, expected: 50},
+		"below the minimum transfer": {wanted: 100, available: 1000, remaining: 40, minTransfer: 50, expected: 0},
+		"at the minimum transfer":    {wanted: 100, available: 1000, remaining: 50, minTransfer: 50, expected: 50},
+		"nothing wanted":             {wanted: -5, available: 1000, remaining: 1000, expected: 0},
+	} {
+		amount := getTransferAmount(
+			decimal.NewFromInt(tc.wanted),
+			decimal.NewFromInt(tc.available),
+			decimal.NewFromInt(tc.feeFactor),
+			decimal.NewFromInt(tc.remaining),
+			decimal.NewFromInt(tc.minTransfer),
+		)
+		if !amount.Equal(decimal.NewFromInt(tc.expected)) {
+			t.Errorf("%s: expected %d, got %s", name, tc.expected, amount)
+		}
+	}
+}
+
+func TestGetTransferAmountTruncates(t *testing.T) {
+	// 100 / 1.003 = 99.70..., which cannot be sent as a fraction of the smallest asset unit
+	amount := getTransferAmount(
+		decimal.NewFromInt(100),
+		decimal.NewFromInt(100),
+		decimal.RequireFromString("0.003"),
+		decimal.NewFromInt(1000),
+		decimal.Zero,
+	)
+	if !amount.Equal(decimal.NewFromInt(99)) {
+		t.Fatalf("expected 99, got %s", amount)
+	}
+}
+
+func TestGetTransferredToday(t *testing.T) {
+	now := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	today := now.Add(-time.Hour).UnixNano()
+	yesterday := now.Add(-13 * time.Hour).UnixNano()
+	transfers := []*eventspb.Transfer{
+		{Asset: "a", Amount: "10", Reference: TopUpReference, Status: eventspb.Transfer_STATUS_DONE, Timestamp: today},
+		{Asset: "a", Amount: "20", Reference: SweepReference, Status: eventspb.Transfer_STATUS_DONE, Timestamp: today},
+		{Asset: "b", Amount: "5", Reference: TopUpReference, Status: eventspb.Transfer_STATUS_DONE, Timestamp: today},
+		{Asset: "a", Amount: "40", Reference: TopUpReference, Status: eventspb.Transfer_STATUS_DONE, Timestamp: yesterday},
+		{Asset: "a", Amount: "80", Reference: TopUpReference, Status: eventspb.Transfer_STATUS_REJECTED, Timestamp: today},
+		{Asset: "a", Amount: "160", Reference: "manual", Status: eventspb.Transfer_STATUS_DONE, Timestamp: today},
+	}
+	totals := getTransferredToday(transfers, now)
+	if !totals["a"].Equal(decimal.NewFromInt(30)) || !totals["b"].Equal(decimal.NewFromInt(5)) || len(totals) != 2 {
+		t.Fatalf("unexpected totals %v", totals)
+	}
+}
@@ -0,0 +1,214 @@
+package txmanager
+
+import (
+	corepb "code.vegaprotocol.io/vega/protos/vega/api/v1"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"vega-cli-mm/auth"
+	"vega-cli-mm/logging"
+	"vega-cli-mm/store"
+)
+
+// MaxAttempts is how many times a transaction is signed and sent before a retriable failure is given up on
+const MaxAttempts = 3
+
+// SubmitTimeout bounds each attempt to send a signed transaction to the core node, within the caller's deadline
+const SubmitTimeout = 10 * time.Second
+
+// ABCI codes Vega returns for transactions it refuses to include in a block
+const (
+	AbciTxnValidationFailure = 51
+	AbciTxnDecodingFailure   = 60
+	AbciTxnInternalError     = 70
+	AbciUnknownCommandError  = 80
+	AbciSpamError            = 89
+)
+
+type FailureKind string
+
+const (
+	PowInvalid FailureKind = "powInvalid"
+	SpamBan    FailureKind = "spamBan"
+	// InsufficientMargin is never returned when a transaction is sent, since Vega only checks margin once the
+	// transaction is executed. The bot reports it from rejected orders on the orders stream.
+	InsufficientMargin FailureKind = "insufficientMargin"
+	BlockHeightTooOld  FailureKind = "blockHeightTooOld"
+	SubmitError        FailureKind = "submitError"
+	Unknown            FailureKind = "unknown"
+)
+
+// idempotentCommands have the same effect however many times Vega executes them
+var idempotentCommands = map[string]bool{
+	"orderCancellation":              true,
+	"liquidityProvisionCancellation": true,
+}
+
+// Retriable failures are worth sending again with a fresh block height and PoW. A command that failed to send is
+// only sent again if it is idempotent, because it may still have reached the node, and sending an order, commitment
+// or transfer again could execute it twice.
+func (k FailureKind) Retriable(commandType string) bool {
+	if k == SubmitError {
+		return idempotentCommands[commandType]
+	}
+	return k == PowInvalid || k == BlockHeightTooOld
+}
+
+// Classify works out why Vega rejected a transaction from its ABCI response code. Vega's spam protection returns
+// the same code for an invalid or stale PoW as for a ban, so only within that code is the error message used to
+// tell them apart, and anything it does not recognise is treated as a ban so that it is never retried.
+func Classify(code uint32, data string) FailureKind {
+	if code != AbciSpamError {
+		return Unknown
+	}
+	message := strings.ToLower(data)
+	switch {
+	case strings.Contains(message, "too old") || strings.Contains(message, "unknown block height"):
+		return BlockHeightTooOld
+	case strings.Contains(message, "banned"):
+		return SpamBan
+	case strings.Contains(message, "proof of work") || strings.Contains(message, "pow"):
+		return PowInvalid
+	}
+	return SpamBan
+}
+
+// TxError is returned for a transaction that failed permanently, or kept failing until MaxAttempts was reached
+type TxError struct {
+	Record *store.TxRecord
+}
+
+func (e *TxError) Error() string {
+	command := e.Record.CommandType
+	if len(e.Record.MarketId) > 0 {
+		command = fmt.Sprintf("%s for market %s", command, e.Record.MarketId)
+	}
+	return fmt.Sprintf("%s from %s failed after %d attempts: %s (code %d) %s", command, e.Record.PartyId,
+		e.Record.Attempts, e.Record.Failure, e.Record.Code, e.Record.Data)
+}
+
+// TxManager signs and sends every transaction, records the outcome in the store and retries failures that a fresh
+// PoW can fix. Transactions that still fail are also published on Failures for the bot to act on.
+type TxManager struct {
+	authenticator *auth.Authenticator
+	store         *store.Store
+	failures      chan *TxError
+}
+
+func NewTxManager(
+	authenticator *auth.Authenticator,
+	store *store.Store,
+) *TxManager {
+	return &TxManager{
+		authenticator: authenticator,
+		store:         store,
+		failures:      make(chan *TxError, 100),
+	}
+}
+
+func (m *TxManager) Failures() <-chan *TxError {
+	return m.failures
+}
+
+// Submit returns an error from Sign, such as auth.ErrNoProofOfWork, unwrapped so that the caller can decide whether
+// to drop the transaction, and a *TxError once Vega has rejected it for good. Each wait for PoW and each send is
+// bounded by auth.PowWaitTimeout and SubmitTimeout, and no further attempt is made once ctx is done.
+func (m *TxManager) Submit(
+	ctx context.Context,
+	partyId string,
+	marketId string,
+	inputData *commandspb.InputData,
+) error {
+	record := &store.TxRecord{
+		CommandType: commandType(inputData),
+		MarketId:    marketId,
+		PartyId:     partyId,
+	}
+	for record.Attempts < MaxAttempts && ctx.Err() == nil {
+		tx, err := m.sign(ctx, partyId, inputData)
+		if err != nil {
+			if record.Attempts == 0 {
+				return err
+			}
+			break
+		}
+		record.Attempts++
+		record.SubmittedAt = time.Now().UnixNano()
+		resp, err := m.submit(ctx, tx)
+		if err != nil {
+			record.Failure = string(SubmitError)
+			record.Data = err.Error()
+			if !SubmitError.Retriable(record.CommandType) {
+				break
+			}
+			continue
+		}
+		record.TxHash = resp.TxHash
+		record.Success = resp.Success
+		record.Code = resp.Code
+		record.Data = resp.Data
+		if resp.Success {
+			record.Failure = ""
+			break
+		}
+		failure := Classify(resp.Code, resp.Data)
+		record.Failure = string(failure)
+		if !failure.Retriable(record.CommandType) {
+			break
+		}
+		logging.GetLogger().Debugf("retrying %s for market %s from %s after %s", record.CommandType, marketId,
+			partyId, record.Failure)
+	}
+	m.store.SaveTxRecord(record)
+	if record.Success {
+		return nil
+	}
+	txErr := &TxError{Record: record}
+	select {
+	case m.failures <- txErr:
+	default:
+		logging.GetLogger().Warnf("dropped tx failure notification, nobody is reading them")
+	}
+	return txErr
+}
+
+func (m *TxManager) sign(
+	ctx context.Context,
+	partyId string,
+	inputData *commandspb.InputData,
+) (*commandspb.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, auth.PowWaitTimeout)
+	defer cancel()
+	return m.authenticator.Sign(ctx, partyId, inputData)
+}
+
+func (m *TxManager) submit(
+	ctx context.Context,
+	tx *commandspb.Transaction,
+) (*corepb.SubmitTransactionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, SubmitTimeout)
+	defer cancel()
+	return m.authenticator.SubmitTx(ctx, tx)
+}
+
+func commandType(inputData *commandspb.InputData) string {
+	switch inputData.Command.(type) {
+	case *commandspb.InputData_OrderSubmission:
+		return "orderSubmission"
+	case *commandspb.InputData_OrderCancellation:
+		return "orderCancellation"
+	case *commandspb.InputData_OrderAmendment:
+		return "orderAmendment"
+	case *commandspb.InputData_BatchMarketInstructions:
+		return "batchMarketInstructions"
+	case *commandspb.InputData_LiquidityProvisionSubmission:
+		return "liquidityProvisionSubmission"
+	case *commandspb.InputData_LiquidityProvisionCancellation:
+		return "liquidityProvisionCancellation"
+	case *commandspb.InputData_Transfer:
+		return "transfer"
+	}
+	return fmt.Sprintf("%T", inputData.Command)
+}
@@ -0,0 +1,39 @@
+package txmanager
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	for name, tc := range map[string]struct {
+		code     uint32
+		data     string
+		expected FailureKind
+	}{
+		"stale block height": {AbciSpamError, "unknown block height for tx", BlockHeightTooOld},
+		"invalid pow":        {AbciSpamError, "failed to verify proof of work", PowInvalid},
+		"banned":             {AbciSpamError, "party is banned from sending transactions", SpamBan},
+		"other spam":         {AbciSpamError, "too many transactions per block", SpamBan},
+		"validation failure": {AbciTxnValidationFailure, "order size must be positive", Unknown},
+		"margin in message":  {AbciTxnInternalError, "insufficient margin", Unknown},
+	} {
+		if failure := Classify(tc.code, tc.data); failure != tc.expected {
+			t.Errorf("%s: expected %s, got %s", name, tc.expected, failure)
+		}
+	}
+}
+
+func TestSubmitErrorIsOnlyRetriedForIdempotentCommands(t *testing.T) {
+	for _, commandType := range []string{"orderCancellation", "liquidityProvisionCancellation"} {
+		if !SubmitError.Retriable(commandType) {
+			t.Errorf("expected %s that failed to send to be retried", commandType)
+		}
+	}
+	for _, commandType := range []string{"orderSubmission", "orderAmendment", "batchMarketInstructions",
+		"liquidityProvisionSubmission", "transfer"} {
+		if SubmitError.Retriable(commandType) {
+			t.Errorf("expected %s that failed to send not to be retried", commandType)
+		}
+	}
+	if !PowInvalid.Retriable("transfer") {
+		t.Fatal("expected a transfer rejected for its proof of work to be retried")
+	}
+}
@@ -4,23 +4,48 @@ import (
 	"code.vegaprotocol.io/vega/libs/ptr"
 	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
 	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	eventspb "code.vegaprotocol.io/vega/protos/vega/events/v1"
 	"context"
+	"fmt"
+	"github.com/sasha-s/go-deadlock"
+	"github.com/shopspring/decimal"
+	"golang.org/x/exp/maps"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"vega-cli-mm/auth"
 	"vega-cli-mm/logging"
 	"vega-cli-mm/store"
+	"vega-cli-mm/txmanager"
 )
 
+type ConnectionState struct {
+	MarketData          bool            `json:"marketData"`
+	Orders              bool            `json:"orders"`
+	Trades              bool            `json:"trades"`
+	Accounts            map[string]bool `json:"accounts"`
+	Positions           map[string]bool `json:"positions"`
+	LiquidityProvisions map[string]bool `json:"liquidityProvisions"`
+}
+
 type Vega struct {
 	authenticator                *auth.Authenticator
+	txManager                    *txmanager.TxManager
 	store                        *store.Store
 	coreNode                     string
 	accountsConnected            map[string]bool
 	marketDataConnected          bool
 	ordersConnected              bool
+	tradesConnected              bool
 	positionsConnected           map[string]bool
 	liquidityProvisionsConnected map[string]bool
+	marketDataCancel             context.CancelFunc
+	ordersCancel                 context.CancelFunc
+	tradesCancel                 context.CancelFunc
+	marketDataGeneration         uint64
+	ordersGeneration             uint64
+	tradesGeneration             uint64
+	connectionsLock              deadlock.RWMutex
 }
 
 func NewVega(
@@ -40,8 +65,14 @@ func (v *Vega) GetAuthenticator() *auth.Authenticator {
 	return v.authenticator
 }
 
+// SetAuthenticator also creates the transaction manager every transaction is sent through
 func (v *Vega) SetAuthenticator(authenticator *auth.Authenticator) {
 	v.authenticator = authenticator
+	v.txManager = txmanager.NewTxManager(authenticator, v.store)
+}
+
+func (v *Vega) GetTxManager() *txmanager.TxManager {
+	return v.txManager
 }
 
 func (v *Vega) GetCoreNode() string {
@@ -49,191 +80,587 @@ func (v *Vega) GetCoreNode() string {
 }
 
 func (v *Vega) IsAccountsConnected(partyId string) bool {
+	v.connectionsLock.RLock()
+	defer v.connectionsLock.RUnlock()
 	return v.accountsConnected[partyId]
 }
 
 func (v *Vega) IsMarketDataConnected() bool {
+	v.connectionsLock.RLock()
+	defer v.connectionsLock.RUnlock()
 	return v.marketDataConnected
 }
 
 func (v *Vega) IsOrdersConnected() bool {
+	v.connectionsLock.RLock()
+	defer v.connectionsLock.RUnlock()
 	return v.ordersConnected
 }
 
+func (v *Vega) IsTradesConnected() bool {
+	v.connectionsLock.RLock()
+	defer v.connectionsLock.RUnlock()
+	return v.tradesConnected
+}
+
 func (v *Vega) IsPositionsConnected(partyId string) bool {
+	v.connectionsLock.RLock()
+	defer v.connectionsLock.RUnlock()
 	return v.positionsConnected[partyId]
 }
 
 func (v *Vega) IsLiquidityProvisionsConnected(partyId string) bool {
+	v.connectionsLock.RLock()
+	defer v.connectionsLock.RUnlock()
 	return v.liquidityProvisionsConnected[partyId]
 }
 
-func (v *Vega) GetAssets() []*vegapb.Asset {
-	assets := make([]*vegapb.Asset, 0)
+// GetConnectionState returns a copy of the stream connection state that is safe to read
+// while the streams continue to connect and disconnect
+func (v *Vega) GetConnectionState() *ConnectionState {
+	v.connectionsLock.RLock()
+	defer v.connectionsLock.RUnlock()
+	return &ConnectionState{
+		MarketData:          v.marketDataConnected,
+		Orders:              v.ordersConnected,
+		Trades:              v.tradesConnected,
+		Accounts:            maps.Clone(v.accountsConnected),
+		Positions:           maps.Clone(v.positionsConnected),
+		LiquidityProvisions: maps.Clone(v.liquidityProvisionsConnected),
+	}
+}
+
+// startMarketDataStream marks a newly established market data stream as connected and returns its generation.
+// Only the current generation can mark the stream down, so a stream that has been replaced cannot disconnect its
+// successor.
+func (v *Vega) startMarketDataStream(cancel context.CancelFunc) uint64 {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	v.marketDataGeneration++
+	v.marketDataCancel = cancel
+	v.marketDataConnected = true
+	return v.marketDataGeneration
+}
+
+func (v *Vega) endMarketDataStream(generation uint64) {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	if generation != v.marketDataGeneration {
+		return
+	}
+	v.marketDataCancel = nil
+	v.marketDataConnected = false
+}
+
+// startOrdersStream works like startMarketDataStream
+func (v *Vega) startOrdersStream(cancel context.CancelFunc) uint64 {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	v.ordersGeneration++
+	v.ordersCancel = cancel
+	v.ordersConnected = true
+	return v.ordersGeneration
+}
+
+func (v *Vega) endOrdersStream(generation uint64) {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	if generation != v.ordersGeneration {
+		return
+	}
+	v.ordersCancel = nil
+	v.ordersConnected = false
+}
+
+// RestartMarketDataStream tears down the market data stream so that it is re-established on the next connect attempt
+func (v *Vega) RestartMarketDataStream() {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	if v.marketDataCancel != nil {
+		v.marketDataCancel()
+		v.marketDataCancel = nil
+	}
+	v.marketDataConnected = false
+}
+
+// RestartOrdersStream tears down the orders stream so that it is re-established on the next connect attempt
+func (v *Vega) RestartOrdersStream() {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	if v.ordersCancel != nil {
+		v.ordersCancel()
+		v.ordersCancel = nil
+	}
+	v.ordersConnected = false
+}
+
+// startTradesStream works like startMarketDataStream. The trades stream sends nothing until one of our parties
+// trades, so it has to count as connected as soon as it is established.
+func (v *Vega) startTradesStream(cancel context.CancelFunc) uint64 {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	v.tradesGeneration++
+	v.tradesCancel = cancel
+	v.tradesConnected = true
+	return v.tradesGeneration
+}
+
+func (v *Vega) endTradesStream(generation uint64) {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	if generation != v.tradesGeneration {
+		return
+	}
+	v.tradesCancel = nil
+	v.tradesConnected = false
+}
+
+// RestartTradesStream tears down the trades stream so that it is re-established on the next connect attempt
+func (v *Vega) RestartTradesStream() {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	if v.tradesCancel != nil {
+		v.tradesCancel()
+		v.tradesCancel = nil
+	}
+	v.tradesConnected = false
+}
+
+func (v *Vega) setAccountsConnected(partyId string, connected bool) {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	v.accountsConnected[partyId] = connected
+}
+
+func (v *Vega) setPositionsConnected(partyId string, connected bool) {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	v.positionsConnected[partyId] = connected
+}
+
+func (v *Vega) setLiquidityProvisionsConnected(partyId string, connected bool) {
+	v.connectionsLock.Lock()
+	defer v.connectionsLock.Unlock()
+	v.liquidityProvisionsConnected[partyId] = connected
+}
+
+func (v *Vega) GetAssets() ([]*vegapb.Asset, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list assets: %v", err)
-		return assets
+		return nil, fmt.Errorf("could not list assets: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListAssetsRequest{}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListAssets(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list assets: %v", err)
-		return assets
+		return nil, fmt.Errorf("could not list assets: %w", err)
 	}
+	assets := make([]*vegapb.Asset, 0)
 	for _, edge := range resp.Assets.Edges {
 		assets = append(assets, edge.Node)
 	}
-	return assets
+	return assets, nil
 }
 
-func (v *Vega) GetMarkets() []*vegapb.Market {
-	markets := make([]*vegapb.Market, 0)
+func (v *Vega) GetMarkets() ([]*vegapb.Market, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list markets: %v", err)
-		return markets
+		return nil, fmt.Errorf("could not list markets: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListMarketsRequest{}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListMarkets(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list markets: %v", err)
-		return markets
+		return nil, fmt.Errorf("could not list markets: %w", err)
 	}
+	markets := make([]*vegapb.Market, 0)
 	for _, edge := range resp.Markets.Edges {
 		markets = append(markets, edge.Node)
 	}
-	return markets
+	return markets, nil
 }
 
-func (v *Vega) GetMarketData() []*vegapb.MarketData {
-	marketData := make([]*vegapb.MarketData, 0)
+func (v *Vega) GetMarketData() ([]*vegapb.MarketData, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list market data: %v", err)
-		return marketData
+		return nil, fmt.Errorf("could not list market data: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListLatestMarketDataRequest{}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListLatestMarketData(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list market data: %v", err)
-		return marketData
+		return nil, fmt.Errorf("could not list market data: %w", err)
 	}
+	marketData := make([]*vegapb.MarketData, 0)
 	for _, data := range resp.MarketsData {
 		marketData = append(marketData, data)
 	}
-	return marketData
+	return marketData, nil
 }
 
 func (v *Vega) GetAccounts(
 	partyIds []string,
-) []*apipb.AccountBalance {
-	accounts := make([]*apipb.AccountBalance, 0)
+) ([]*apipb.AccountBalance, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list accounts: %v", err)
-		return accounts
+		return nil, fmt.Errorf("could not list accounts: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListAccountsRequest{Filter: &apipb.AccountFilter{PartyIds: partyIds}}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListAccounts(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list accounts: %v", err)
-		return accounts
+		return nil, fmt.Errorf("could not list accounts: %w", err)
 	}
+	accounts := make([]*apipb.AccountBalance, 0)
 	for _, edge := range resp.Accounts.Edges {
 		accounts = append(accounts, edge.Node)
 	}
-	return accounts
+	return accounts, nil
+}
+
+func (v *Vega) GetEpoch(
+	seq *uint64,
+) (*vegapb.Epoch, error) {
+	epochs, err := v.GetEpochs([]*uint64{seq})
+	if err != nil {
+		return nil, err
+	}
+	return epochs[0], nil
+}
+
+// GetEpochs fetches each epoch over one connection, a nil sequence number being the current epoch
+func (v *Vega) GetEpochs(
+	seqs []*uint64,
+) ([]*vegapb.Epoch, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not get epochs: %w", err)
+	}
+	defer node.Close()
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	epochs := make([]*vegapb.Epoch, 0, len(seqs))
+	for _, seq := range seqs {
+		resp, err := tradingDataService.GetEpoch(context.Background(), &apipb.GetEpochRequest{Id: seq})
+		if err != nil {
+			return nil, fmt.Errorf("could not get epoch: %w", err)
+		}
+		epochs = append(epochs, resp.Epoch)
+	}
+	return epochs, nil
+}
+
+// GetRewards lists the rewards paid to each party from the given epoch onwards, over one connection
+func (v *Vega) GetRewards(
+	partyIds []string,
+	fromEpoch uint64,
+) ([]*vegapb.Reward, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not list rewards: %w", err)
+	}
+	defer node.Close()
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	rewards := make([]*vegapb.Reward, 0)
+	for _, partyId := range partyIds {
+		req := &apipb.ListRewardsRequest{
+			PartyId:    partyId,
+			FromEpoch:  ptr.From(fromEpoch),
+			Pagination: &apipb.Pagination{},
+		}
+		for {
+			resp, err := tradingDataService.ListRewards(context.Background(), req)
+			if err != nil {
+				return nil, fmt.Errorf("could not list rewards for party %s: %w", partyId, err)
+			}
+			for _, edge := range resp.Rewards.Edges {
+				rewards = append(rewards, edge.Node)
+			}
+			pageInfo := resp.Rewards.PageInfo
+			if pageInfo == nil || !pageInfo.HasNextPage {
+				break
+			}
+			req.Pagination.After = ptr.From(pageInfo.EndCursor)
+		}
+	}
+	return rewards, nil
+}
+
+func (v *Vega) GetDeposits(
+	partyId string,
+) ([]*vegapb.Deposit, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not list deposits: %w", err)
+	}
+	defer node.Close()
+	req := &apipb.ListDepositsRequest{PartyId: partyId, Pagination: &apipb.Pagination{}}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	deposits := make([]*vegapb.Deposit, 0)
+	for {
+		resp, err := tradingDataService.ListDeposits(context.Background(), req)
+		if err != nil {
+			return nil, fmt.Errorf("could not list deposits: %w", err)
+		}
+		for _, edge := range resp.Deposits.Edges {
+			deposits = append(deposits, edge.Node)
+		}
+		pageInfo := resp.Deposits.PageInfo
+		if pageInfo == nil || !pageInfo.HasNextPage {
+			return deposits, nil
+		}
+		req.Pagination.After = ptr.From(pageInfo.EndCursor)
+	}
+}
+
+func (v *Vega) GetWithdrawals(
+	partyId string,
+) ([]*vegapb.Withdrawal, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not list withdrawals: %w", err)
+	}
+	defer node.Close()
+	req := &apipb.ListWithdrawalsRequest{PartyId: partyId, Pagination: &apipb.Pagination{}}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	withdrawals := make([]*vegapb.Withdrawal, 0)
+	for {
+		resp, err := tradingDataService.ListWithdrawals(context.Background(), req)
+		if err != nil {
+			return nil, fmt.Errorf("could not list withdrawals: %w", err)
+		}
+		for _, edge := range resp.Withdrawals.Edges {
+			withdrawals = append(withdrawals, edge.Node)
+		}
+		pageInfo := resp.Withdrawals.PageInfo
+		if pageInfo == nil || !pageInfo.HasNextPage {
+			return withdrawals, nil
+		}
+		req.Pagination.After = ptr.From(pageInfo.EndCursor)
+	}
+}
+
+// GetTransfers lists every transfer to or from the party
+func (v *Vega) GetTransfers(
+	partyId string,
+) ([]*eventspb.Transfer, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not list transfers: %w", err)
+	}
+	defer node.Close()
+	req := &apipb.ListTransfersRequest{
+		Pubkey:     ptr.From(partyId),
+		Direction:  apipb.TransferDirection_TRANSFER_DIRECTION_TRANSFER_TO_OR_FROM,
+		Pagination: &apipb.Pagination{},
+	}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	transfers := make([]*eventspb.Transfer, 0)
+	for {
+		resp, err := tradingDataService.ListTransfers(context.Background(), req)
+		if err != nil {
+			return nil, fmt.Errorf("could not list transfers: %w", err)
+		}
+		for _, edge := range resp.Transfers.Edges {
+			transfers = append(transfers, edge.Node)
+		}
+		pageInfo := resp.Transfers.PageInfo
+		if pageInfo == nil || !pageInfo.HasNextPage {
+			return transfers, nil
+		}
+		req.Pagination.After = ptr.From(pageInfo.EndCursor)
+	}
+}
+
+func (v *Vega) GetMarginLevels(
+	partyId string,
+) ([]*vegapb.MarginLevels, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not list margin levels: %w", err)
+	}
+	defer node.Close()
+	req := &apipb.ListMarginLevelsRequest{PartyId: partyId}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	resp, err := tradingDataService.ListMarginLevels(context.Background(), req)
+	if err != nil {
+		return nil, fmt.Errorf("could not list margin levels: %w", err)
+	}
+	marginLevels := make([]*vegapb.MarginLevels, 0)
+	for _, edge := range resp.MarginLevels.Edges {
+		marginLevels = append(marginLevels, edge.Node)
+	}
+	return marginLevels, nil
 }
 
 func (v *Vega) GetOrders(
 	partyIds []string,
-) []*vegapb.Order {
-	orders := make([]*vegapb.Order, 0)
+) ([]*vegapb.Order, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list orders: %v", err)
-		return orders
+		return nil, fmt.Errorf("could not list orders: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListOrdersRequest{Filter: &apipb.OrderFilter{PartyIds: partyIds, LiveOnly: ptr.From(true)}}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListOrders(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list orders: %v", err)
-		return orders
+		return nil, fmt.Errorf("could not list orders: %w", err)
 	}
+	orders := make([]*vegapb.Order, 0)
 	for _, edge := range resp.Orders.Edges {
 		orders = append(orders, edge.Node)
 	}
-	return orders
+	return orders, nil
+}
+
+func (v *Vega) GetTrades(
+	partyIds []string,
+) ([]*vegapb.Trade, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not list trades: %w", err)
+	}
+	defer node.Close()
+	req := &apipb.ListTradesRequest{PartyIds: partyIds, Pagination: &apipb.Pagination{}}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	trades := make([]*vegapb.Trade, 0)
+	for {
+		resp, err := tradingDataService.ListTrades(context.Background(), req)
+		if err != nil {
+			return nil, fmt.Errorf("could not list trades: %w", err)
+		}
+		for _, edge := range resp.Trades.Edges {
+			trades = append(trades, edge.Node)
+		}
+		pageInfo := resp.Trades.PageInfo
+		if pageInfo == nil || !pageInfo.HasNextPage {
+			return trades, nil
+		}
+		req.Pagination.After = ptr.From(pageInfo.EndCursor)
+	}
+}
+
+// GetMidPrice returns the market's mid price at the timestamp, in nanoseconds, from the data node's market data history
+func (v *Vega) GetMidPrice(
+	marketId string,
+	timestamp int64,
+) (decimal.Decimal, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return decimal.Zero, err
+	}
+	defer node.Close()
+	req := &apipb.GetMarketDataHistoryByIDRequest{
+		MarketId:     marketId,
+		EndTimestamp: ptr.From(timestamp),
+		Pagination:   &apipb.Pagination{Last: ptr.From(int32(1))},
+	}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	resp, err := tradingDataService.GetMarketDataHistoryByID(context.Background(), req)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if resp.MarketData == nil || len(resp.MarketData.Edges) == 0 {
+		return decimal.Zero, fmt.Errorf("no market data for market %s at %d", marketId, timestamp)
+	}
+	return store.ParseDecimal(resp.MarketData.Edges[0].Node.MidPrice), nil
+}
+
+func (v *Vega) GetLedgerEntries(
+	partyIds []string,
+	transferTypes []vegapb.TransferType,
+) ([]*apipb.AggregatedLedgerEntry, error) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("could not list ledger entries: %w", err)
+	}
+	defer node.Close()
+	req := &apipb.ListLedgerEntriesRequest{Filter: &apipb.LedgerEntryFilter{
+		FromAccountFilter: &apipb.AccountFilter{PartyIds: partyIds},
+		ToAccountFilter:   &apipb.AccountFilter{PartyIds: partyIds},
+		TransferTypes:     transferTypes,
+	}, Pagination: &apipb.Pagination{}}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	entries := make([]*apipb.AggregatedLedgerEntry, 0)
+	for {
+		resp, err := tradingDataService.ListLedgerEntries(context.Background(), req)
+		if err != nil {
+			return nil, fmt.Errorf("could not list ledger entries: %w", err)
+		}
+		for _, edge := range resp.LedgerEntries.Edges {
+			entries = append(entries, edge.Node)
+		}
+		pageInfo := resp.LedgerEntries.PageInfo
+		if pageInfo == nil || !pageInfo.HasNextPage {
+			return entries, nil
+		}
+		req.Pagination.After = ptr.From(pageInfo.EndCursor)
+	}
 }
 
 func (v *Vega) GetPositions(
 	partyIds []string,
-) []*vegapb.Position {
-	positions := make([]*vegapb.Position, 0)
+) ([]*vegapb.Position, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list positions: %v", err)
-		return positions
+		return nil, fmt.Errorf("could not list positions: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListAllPositionsRequest{Filter: &apipb.PositionsFilter{PartyIds: partyIds}}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListAllPositions(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list positions: %v", err)
-		return positions
+		return nil, fmt.Errorf("could not list positions: %w", err)
 	}
+	positions := make([]*vegapb.Position, 0)
 	for _, edge := range resp.Positions.Edges {
 		positions = append(positions, edge.Node)
 	}
-	return positions
+	return positions, nil
 }
 
-func (v *Vega) GetNetworkParameters() []*vegapb.NetworkParameter {
-	networkParameters := make([]*vegapb.NetworkParameter, 0)
+func (v *Vega) GetNetworkParameters() ([]*vegapb.NetworkParameter, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list network parameters: %v", err)
-		return networkParameters
+		return nil, fmt.Errorf("could not list network parameters: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListNetworkParametersRequest{}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListNetworkParameters(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list network parameters: %v", err)
-		return networkParameters
+		return nil, fmt.Errorf("could not list network parameters: %w", err)
 	}
+	networkParameters := make([]*vegapb.NetworkParameter, 0)
 	for _, edge := range resp.NetworkParameters.Edges {
 		networkParameters = append(networkParameters, edge.Node)
 	}
-	return networkParameters
+	return networkParameters, nil
 }
 
 func (v *Vega) GetLiquidityProvisions(
 	partyId string,
-) []*vegapb.LiquidityProvision {
-	liquidityProvisions := make([]*vegapb.LiquidityProvision, 0)
+) ([]*vegapb.LiquidityProvision, error) {
 	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		logging.GetLogger().Warnf("could not list liquidity provisions: %v", err)
-		return liquidityProvisions
+		return nil, fmt.Errorf("could not list liquidity provisions: %w", err)
 	}
+	defer node.Close()
 	req := &apipb.ListLiquidityProvisionsRequest{PartyId: ptr.From(partyId)}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
 	resp, err := tradingDataService.ListLiquidityProvisions(context.Background(), req)
 	if err != nil {
-		logging.GetLogger().Warnf("could not list liquidity provisions: %v", err)
-		return liquidityProvisions
+		return nil, fmt.Errorf("could not list liquidity provisions: %w", err)
 	}
+	liquidityProvisions := make([]*vegapb.LiquidityProvision, 0)
 	for _, edge := range resp.LiquidityProvisions.Edges {
 		liquidityProvisions = append(liquidityProvisions, edge.Node)
 	}
-	return liquidityProvisions
+	return liquidityProvisions, nil
 }
 
 func (v *Vega) StreamMarketData(
@@ -247,22 +674,26 @@ func (v *Vega) StreamMarketData(
 	}
 	req := &apipb.ObserveMarketsDataRequest{MarketIds: marketIds}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
-	stream, err := tradingDataService.ObserveMarketsData(context.Background(), req)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := tradingDataService.ObserveMarketsData(ctx, req)
 	if err != nil {
 		logging.GetLogger().Warnf("could not start market data stream: %v", err)
+		cancel()
+		_ = node.Close()
 		return
 	}
+	generation := v.startMarketDataStream(cancel)
 	go func() {
+		defer node.Close()
+		defer cancel()
 		for {
 			resp, err := stream.Recv()
 			if err != nil {
 				logging.GetLogger().Warnf("could not recv market data: %v", err)
-				v.marketDataConnected = false
+				v.endMarketDataStream(generation)
 				break
-			} else {
-				v.marketDataConnected = true
-				callback(resp.MarketData)
 			}
+			callback(resp.MarketData)
 		}
 	}()
 }
@@ -278,31 +709,70 @@ func (v *Vega) StreamOrders(
 	}
 	req := &apipb.ObserveOrdersRequest{PartyIds: partyIds}
 	tradingDataService := apipb.NewTradingDataServiceClient(node)
-	stream, err := tradingDataService.ObserveOrders(context.Background(), req)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := tradingDataService.ObserveOrders(ctx, req)
 	if err != nil {
 		logging.GetLogger().Warnf("could not start orders stream: %v", err)
+		cancel()
+		_ = node.Close()
 		return
 	}
+	generation := v.startOrdersStream(cancel)
 	go func() {
+		defer node.Close()
+		defer cancel()
 		for {
 			resp, err := stream.Recv()
 			if err != nil {
 				logging.GetLogger().Warnf("could not recv orders: %v", err)
-				v.ordersConnected = false
+				v.endOrdersStream(generation)
 				break
-			} else {
-				v.ordersConnected = true
-				switch r := resp.Response.(type) {
-				case *apipb.ObserveOrdersResponse_Snapshot:
-					callback(r.Snapshot.Orders)
-				case *apipb.ObserveOrdersResponse_Updates:
-					callback(r.Updates.Orders)
-				}
+			}
+			switch r := resp.Response.(type) {
+			case *apipb.ObserveOrdersResponse_Snapshot:
+				callback(r.Snapshot.Orders)
+			case *apipb.ObserveOrdersResponse_Updates:
+				callback(r.Updates.Orders)
 			}
 		}
 	}()
 }
 
+func (v *Vega) StreamTrades(
+	partyIds []string,
+	callback func(trades []*vegapb.Trade),
+) {
+	node, err := grpc.Dial(v.coreNode, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logging.GetLogger().Warnf("could not start trades stream: %v", err)
+		return
+	}
+	req := &apipb.ObserveTradesRequest{PartyIds: partyIds}
+	tradingDataService := apipb.NewTradingDataServiceClient(node)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := tradingDataService.ObserveTrades(ctx, req)
+	if err != nil {
+		logging.GetLogger().Warnf("could not start trades stream: %v", err)
+		cancel()
+		_ = node.Close()
+		return
+	}
+	generation := v.startTradesStream(cancel)
+	go func() {
+		defer node.Close()
+		defer cancel()
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				logging.GetLogger().Warnf("could not recv trades: %v", err)
+				v.endTradesStream(generation)
+				break
+			}
+			callback(resp.Trades)
+		}
+	}()
+}
+
 func (v *Vega) StreamPositions(
 	partyId string,
 	callback func(positions []*vegapb.Position),
@@ -317,17 +787,19 @@ func (v *Vega) StreamPositions(
 	stream, err := tradingDataService.ObservePositions(context.Background(), req)
 	if err != nil {
 		logging.GetLogger().Warnf("could not start positions stream: %v", err)
+		_ = node.Close()
 		return
 	}
 	go func() {
+		defer node.Close()
 		for {
 			resp, err := stream.Recv()
 			if err != nil {
 				logging.GetLogger().Warnf("could not recv positions: %v", err)
-				v.positionsConnected[partyId] = false
+				v.setPositionsConnected(partyId, false)
 				break
 			} else {
-				v.positionsConnected[partyId] = true
+				v.setPositionsConnected(partyId, true)
 				switch r := resp.Response.(type) {
 				case *apipb.ObservePositionsResponse_Snapshot:
 					callback(r.Snapshot.Positions)
@@ -353,19 +825,21 @@ func (v *Vega) StreamLiquidityProvisions(
 	stream, err := tradingDataService.ObserveLiquidityProvisions(context.Background(), req)
 	if err != nil {
 		logging.GetLogger().Warnf("could not start liquidity provisions stream: %v", err)
+		_ = node.Close()
 		return
 	}
+	// nothing is sent until the party's commitment changes, so the stream counts as connected once established
+	v.setLiquidityProvisionsConnected(partyId, true)
 	go func() {
+		defer node.Close()
 		for {
 			resp, err := stream.Recv()
 			if err != nil {
 				logging.GetLogger().Warnf("could not recv liquidity provisions: %v", err)
-				v.liquidityProvisionsConnected[partyId] = false
+				v.setLiquidityProvisionsConnected(partyId, false)
 				break
-			} else {
-				v.liquidityProvisionsConnected[partyId] = true
-				callback(resp.LiquidityProvisions)
 			}
+			callback(resp.LiquidityProvisions)
 		}
 	}()
 }
@@ -384,17 +858,19 @@ func (v *Vega) StreamAccounts(
 	stream, err := tradingDataService.ObserveAccounts(context.Background(), req)
 	if err != nil {
 		logging.GetLogger().Warnf("could not start accounts stream: %v", err)
+		_ = node.Close()
 		return
 	}
 	go func() {
+		defer node.Close()
 		for {
 			resp, err := stream.Recv()
 			if err != nil {
 				logging.GetLogger().Warnf("could not recv accounts: %v", err)
-				v.accountsConnected[partyId] = false
+				v.setAccountsConnected(partyId, false)
 				break
 			} else {
-				v.accountsConnected[partyId] = true
+				v.setAccountsConnected(partyId, true)
 				switch r := resp.Response.(type) {
 				case *apipb.ObserveAccountsResponse_Snapshot:
 					callback(r.Snapshot.Accounts)
@@ -406,6 +882,69 @@ func (v *Vega) StreamAccounts(
 	}()
 }
 
+func (v *Vega) CancelOrders(
+	ctx context.Context,
+	partyId string,
+	marketId string,
+) error {
+	inputData := &commandspb.InputData{
+		Command: &commandspb.InputData_OrderCancellation{
+			OrderCancellation: &commandspb.OrderCancellation{MarketId: marketId},
+		},
+	}
+	err := v.txManager.Submit(ctx, partyId, marketId, inputData)
+	if err != nil {
+		return fmt.Errorf("could not cancel orders for market %s: %w", marketId, err)
+	}
+	return nil
+}
+
+func (v *Vega) CancelLiquidityProvision(
+	ctx context.Context,
+	partyId string,
+	marketId string,
+) error {
+	inputData := &commandspb.InputData{
+		Command: &commandspb.InputData_LiquidityProvisionCancellation{
+			LiquidityProvisionCancellation: &commandspb.LiquidityProvisionCancellation{MarketId: marketId},
+		},
+	}
+	err := v.txManager.Submit(ctx, partyId, marketId, inputData)
+	if err != nil {
+		return fmt.Errorf("could not cancel liquidity provision for market %s: %w", marketId, err)
+	}
+	return nil
+}
+
+// Transfer moves collateral between the general accounts of two parties. The amount is in asset decimals.
+func (v *Vega) Transfer(
+	ctx context.Context,
+	fromPartyId string,
+	toPartyId string,
+	assetId string,
+	amount string,
+	reference string,
+) error {
+	inputData := &commandspb.InputData{
+		Command: &commandspb.InputData_Transfer{
+			Transfer: &commandspb.Transfer{
+				FromAccountType: vegapb.AccountType_ACCOUNT_TYPE_GENERAL,
+				To:              toPartyId,
+				ToAccountType:   vegapb.AccountType_ACCOUNT_TYPE_GENERAL,
+				Asset:           assetId,
+				Amount:          amount,
+				Reference:       reference,
+				Kind:            &commandspb.Transfer_OneOff{OneOff: &commandspb.OneOffTransfer{}},
+			},
+		},
+	}
+	err := v.txManager.Submit(ctx, fromPartyId, "", inputData)
+	if err != nil {
+		return fmt.Errorf("could not transfer %s %s to %s: %w", amount, assetId, toPartyId, err)
+	}
+	return nil
+}
+
 func (v *Vega) SubmitBatchMarketInstruction() {
 	// TODO - submit batch market instruction
 }
@@ -0,0 +1,75 @@
+package vega
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"vega-cli-mm/store"
+)
+
+func TestConnectionStateConcurrentAccess(t *testing.T) {
+	v := NewVega(store.NewStore(), "localhost:3007")
+	partyIds := []string{"party-a", "party-b", "party-c"}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		connected := i%2 == 0
+		partyId := partyIds[i%len(partyIds)]
+		go func() {
+			defer wg.Done()
+			marketDataGeneration := v.startMarketDataStream(func() {})
+			ordersGeneration := v.startOrdersStream(func() {})
+			tradesGeneration := v.startTradesStream(func() {})
+			v.setAccountsConnected(partyId, connected)
+			v.setPositionsConnected(partyId, connected)
+			v.setLiquidityProvisionsConnected(partyId, connected)
+			v.endMarketDataStream(marketDataGeneration)
+			v.endOrdersStream(ordersGeneration)
+			v.endTradesStream(tradesGeneration)
+			v.RestartMarketDataStream()
+			v.RestartOrdersStream()
+			v.RestartTradesStream()
+		}()
+		go func() {
+			defer wg.Done()
+			v.IsMarketDataConnected()
+			v.IsOrdersConnected()
+			v.IsTradesConnected()
+			v.IsAccountsConnected(partyId)
+			v.IsPositionsConnected(partyId)
+			v.IsLiquidityProvisionsConnected(partyId)
+			state := v.GetConnectionState()
+			_ = fmt.Sprint(state.Accounts, state.Positions, state.LiquidityProvisions)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReplacedStreamCannotDisconnectSuccessor(t *testing.T) {
+	v := NewVega(store.NewStore(), "localhost:3007")
+	oldGeneration := v.startMarketDataStream(func() {})
+	v.RestartMarketDataStream()
+	cancelled := false
+	v.startMarketDataStream(func() { cancelled = true })
+	v.endMarketDataStream(oldGeneration)
+	if !v.IsMarketDataConnected() {
+		t.Fatal("old market data stream disconnected its replacement")
+	}
+	v.RestartMarketDataStream()
+	if !cancelled || v.IsMarketDataConnected() {
+		t.Fatal("expected restart to cancel the current market data stream")
+	}
+}
+
+func TestConnectionStateIsCopied(t *testing.T) {
+	v := NewVega(store.NewStore(), "localhost:3007")
+	v.setAccountsConnected("party-a", true)
+	state := v.GetConnectionState()
+	v.setAccountsConnected("party-a", false)
+	if !state.Accounts["party-a"] {
+		t.Fatal("connection state changed after it was returned")
+	}
+	if v.IsAccountsConnected("party-a") {
+		t.Fatal("expected accounts stream to be disconnected")
+	}
+}
@@ -0,0 +1,80 @@
+package watchdog
+
+import (
+	"github.com/sasha-s/go-deadlock"
+	"time"
+)
+
+type Watchdog struct {
+	marketDataStaleAfter time.Duration
+	ordersStaleAfter     time.Duration
+	startedAt            time.Time
+	lastMarketData       map[string]time.Time
+	lastOrderUpdate      map[string]time.Time
+	lastRestart          map[string]time.Time
+	mu                   deadlock.RWMutex
+}
+
+func NewWatchdog(
+	marketDataStaleAfter time.Duration,
+	ordersStaleAfter time.Duration,
+) *Watchdog {
+	return &Watchdog{
+		marketDataStaleAfter: marketDataStaleAfter,
+		ordersStaleAfter:     ordersStaleAfter,
+		startedAt:            time.Now(),
+		lastMarketData:       map[string]time.Time{},
+		lastOrderUpdate:      map[string]time.Time{},
+		lastRestart:          map[string]time.Time{},
+	}
+}
+
+func (w *Watchdog) MarketDataReceived(marketId string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastMarketData[marketId] = time.Now()
+}
+
+func (w *Watchdog) OrderUpdateReceived(marketId string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastOrderUpdate[marketId] = time.Now()
+}
+
+func (w *Watchdog) StreamsRestarted(marketId string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastRestart[marketId] = time.Now()
+}
+
+// CanRestartStreams returns false until a full staleness window has passed since the last restart,
+// giving the restarted streams a chance to deliver before they are torn down again
+func (w *Watchdog) CanRestartStreams(marketId string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	last, ok := w.lastRestart[marketId]
+	return !ok || time.Since(last) > w.marketDataStaleAfter
+}
+
+func (w *Watchdog) IsMarketDataStale(marketId string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.isStale(w.lastMarketData, marketId, w.marketDataStaleAfter)
+}
+
+func (w *Watchdog) IsOrdersStale(marketId string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.isStale(w.lastOrderUpdate, marketId, w.ordersStaleAfter)
+}
+
+func (w *Watchdog) isStale(lastUpdate map[string]time.Time, marketId string, staleAfter time.Duration) bool {
+	if staleAfter <= 0 {
+		return false
+	}
+	last, ok := lastUpdate[marketId]
+	if !ok {
+		last = w.startedAt
+	}
+	return time.Since(last) > staleAfter
+}